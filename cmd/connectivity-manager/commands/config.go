@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/authentication"
+	"github.com/nalej/connectivity-manager/pkg/notification"
+	"github.com/nalej/connectivity-manager/pkg/policy"
+	cmConfig "github.com/nalej/connectivity-manager/pkg/server/config"
+	"github.com/nalej/derrors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var checkConfig = cmConfig.Config{}
+
+var checkPolicyName string
+
+var checkConfigFile string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration commands",
+	Long:  `Configuration commands`,
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the configuration",
+	Long:  `Check the settings of the run command, taken from the flags, the environment and the configuration file, and the files they refer to without starting the service`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		CheckConfig()
+	},
+}
+
+func init() {
+	bindRunFlags(configCheckCmd.Flags(), &checkConfig, &checkPolicyName)
+	configCheckCmd.Flags().StringVar(&checkConfigFile, "config", "", "YAML file with the settings indexed by their flag name")
+
+	configCmd.AddCommand(configCheckCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// CheckConfig prints all the problems found in the configuration, exiting with an error if there is any.
+func CheckConfig() {
+	conf, problems := loadConfig(configCheckCmd.Flags(), checkConfigFile)
+	problems = append(problems, conf.Problems()...)
+	problems = append(problems, checkConfigFiles(conf)...)
+	if len(problems) == 0 {
+		fmt.Println("configuration is valid")
+		return
+	}
+	fmt.Printf("%d problems found in the configuration:\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("- %s\n", problem.Error())
+	}
+	os.Exit(1)
+}
+
+// checkConfigFiles loads the files the configuration refers to.
+func checkConfigFiles(conf *cmConfig.Config) []derrors.Error {
+	problems := make([]derrors.Error, 0)
+	if conf.PolicyFile != "" {
+		store, err := policy.LoadStore(conf.PolicyFile)
+		if err != nil {
+			problems = append(problems, err)
+		} else if err := conf.ValidThresholdOverrides(store); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if conf.WebhookFile != "" {
+		if _, err := notification.LoadConfig(conf.WebhookFile); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if conf.ClusterKeysFile != "" {
+		if _, err := authentication.LoadKeys(conf.ClusterKeysFile); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/connectivity-manager/pkg/detector"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/policy"
+	"github.com/nalej/connectivity-manager/pkg/recovery"
+	cmConfig "github.com/nalej/connectivity-manager/pkg/server/config"
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+	"os"
+	"time"
+)
+
+// bindRunFlags defines the settings of the run command on a flag set.
+func bindRunFlags(flags *pflag.FlagSet, conf *cmConfig.Config, offlinePolicy *string) {
+	flags.Uint32Var(&conf.Port, "port", 8383, "port where connectivity-manager listens to")
+	flags.Uint32Var(&conf.MetricsPort, "metricsPort", 8384, "port where connectivity-manager serves the Prometheus metrics")
+	flags.StringVar(&conf.SystemModelAddress, "systemModelAddress", "localhost:8800",
+		"System Model address (host:port)")
+	flags.StringVar(&conf.QueueAddress, "queueAddress", "", "address of the nalej bus")
+	flags.BoolVar(&conf.DryRun, "dryRun", false, "Compute the transitions and the offline policies without updating the clusters nor sending requests to the bus")
+	flags.DurationVar(&conf.Threshold, "threshold", time.Minute, "threshold for a cluster to be considered Offline or Online")
+	flags.DurationVar(&conf.PlatformGracePeriod, "platformGracePeriod", 2*time.Minute, "Grace period set by the platform on the clusters, applied to those without one, the threshold must be shorter")
+	flags.IntVar(&conf.ClusterCacheSize, "clusterCacheSize", 1000, "Number of clusters kept in the cache of the cluster alive checks")
+	flags.DurationVar(&conf.HeartbeatFlushInterval, "heartbeatFlushInterval", 10*time.Second, "Period at which the last alive timestamps are written to system model, written on each cluster alive check if zero")
+	flags.DurationVar(&conf.HeartbeatPeriod, "heartbeatPeriod", 15*time.Second, "Period at which the clusters send their cluster alive checks, the flush interval plus this period must be shorter than the thresholds")
+	flags.DurationVar(&conf.ResyncInterval, "resyncInterval", 10*time.Minute, "Period of the full sweeps over all the clusters of system model, the expirations are scheduled on each cluster alive check in between")
+	flags.IntVar(&conf.SweepConcurrency, "sweepConcurrency", 4, "Number of organizations processed in parallel by a full sweep")
+	flags.DurationVar(&conf.SweepTimeout, "sweepTimeout", 5*time.Minute, "Maximum duration of a full sweep, the organizations not processed by then are skipped until the next one")
+	flags.StringVar(offlinePolicy, "offlinePolicy", "none", "Offline policy to trigger when cordoning an offline cluster: none or drain")
+	flags.StringVar(&conf.PolicyFile, "policyFile", "", "JSON file with the offline policy, threshold and grace period overrides per organization and per cluster")
+	flags.IntVar(&conf.MaxConcurrentDrains, "maxConcurrentDrains", 5, "Maximum number of drain requests in flight, the rest wait in the drain queue")
+	flags.DurationVar(&conf.DrainInterval, "drainInterval", 10*time.Second, "Minimum time between two drain requests")
+	flags.DurationVar(&conf.DrainDuration, "drainDuration", 5*time.Minute, "Time a drain request counts as in flight after being sent")
+	flags.IntVar(&conf.DrainBreakerCount, "drainBreakerCount", 0, "Number of clusters going offline within --drainBreakerWindow beyond which the offline policies are suppressed until released, disabled if zero")
+	flags.Float64Var(&conf.DrainBreakerPercentage, "drainBreakerPercentage", 0, "Percentage of the clusters going offline within --drainBreakerWindow beyond which the offline policies are suppressed until released, disabled if zero")
+	flags.DurationVar(&conf.DrainBreakerWindow, "drainBreakerWindow", 5*time.Minute, "Period over which the clusters going offline are counted by the drain breaker")
+	flags.StringVar(&conf.DrainBreakerConfigMap, "drainBreakerConfigMap", "", "Kubernetes ConfigMap in --leaseNamespace where the state of the drain breaker is persisted for the next leader, kept in memory if empty")
+	flags.DurationVar(&conf.ClockSkewTolerance, "clockSkewTolerance", 30*time.Second, "Maximum difference between the timestamp of a cluster alive check and its reception before flagging the clock of the cluster")
+	flags.StringVar(&conf.ClusterKeysFile, "clusterKeysFile", "", "JSON file with the keys of the clusters to verify the signature of the cluster alive checks, not verified if empty")
+	flags.DurationVar(&conf.HeartbeatMaxAge, "heartbeatMaxAge", 5*time.Minute, "Maximum age of a signed cluster alive check")
+	flags.StringVar(&conf.WebhookFile, "webhookFile", "", "JSON file with the webhooks notified of the connectivity changes, globally and per organization")
+	flags.IntVar(&conf.WebhookAttempts, "webhookAttempts", 5, "Maximum number of attempts of each webhook delivery")
+	flags.DurationVar(&conf.WebhookBackoff, "webhookBackoff", time.Second, "Wait after the first failed attempt of a webhook delivery, doubled after each failure")
+	flags.StringVar(&conf.HistoryPath, "historyPath", "", "File where the connectivity history is stored, kept in memory if empty")
+	flags.StringVar(&conf.MaintenancePath, "maintenancePath", "", "File where the maintenance windows are stored, kept in memory if empty")
+	flags.StringVar(&conf.MaintenanceConfigMap, "maintenanceConfigMap", "", "Kubernetes ConfigMap in --leaseNamespace where the maintenance windows are shared by all the replicas, overrides --maintenancePath")
+	flags.StringVar(&conf.RecoveryPolicy, "recoveryPolicy", recovery.None, "Recovery policy to uncordon a cluster that comes back after being cordoned offline: none, heartbeats or window")
+	flags.IntVar(&conf.RecoveryHeartbeats, "recoveryHeartbeats", 5, "Consecutive cluster alive checks required to uncordon a recovered cluster with the heartbeats policy")
+	flags.DurationVar(&conf.RecoveryWindow, "recoveryWindow", 10*time.Minute, "Stability window required to uncordon a recovered cluster with the window policy")
+	flags.StringVar(&conf.Detector, "detector", detector.Threshold, "Failure detector used to consider a cluster offline: threshold or phi")
+	flags.Float64Var(&conf.PhiThreshold, "phiThreshold", detector.DefaultPhiThreshold, "Suspicion level over which the phi detector considers a cluster offline")
+	flags.StringVar(&conf.LeaderElection, "leaderElection", election.None, "Leader election backend used to run the expiration loop in a single replica: none or kubernetes")
+	flags.StringVar(&conf.LeaseName, "leaseName", "connectivity-manager", "Name of the Kubernetes Lease used for the leader election")
+	flags.StringVar(&conf.LeaseNamespace, "leaseNamespace", "", "Namespace of the Kubernetes Lease used for the leader election")
+	flags.DurationVar(&conf.LeaseDuration, "leaseDuration", 15*time.Second, "Time a leader holds the lease without renewing it")
+	flags.StringVar(&conf.PeerAddress, "peerAddress", "%s:8383", "Address of a replica, where %s is replaced by its identity, used to forward to the leader the requests it serves")
+}
+
+// loadConfig builds the configuration of the run command from, in order of precedence, the flags set in the
+// command line, the CM_ environment variables, the configuration file and the defaults of the flags. All the
+// settings that cannot be read are returned as problems, and their defaults are kept.
+func loadConfig(commandLine *pflag.FlagSet, path string) (*cmConfig.Config, []derrors.Error) {
+	conf := &cmConfig.Config{}
+	var offlinePolicy string
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	bindRunFlags(flags, conf, &offlinePolicy)
+	problems := make([]derrors.Error, 0)
+
+	if path != "" {
+		settings, err := cmConfig.ReadFile(path)
+		if err != nil {
+			problems = append(problems, err)
+		}
+		for name, value := range settings {
+			if flags.Lookup(name) == nil {
+				problems = append(problems, derrors.NewInvalidArgumentError("unknown setting in configuration file").WithParams(name))
+				continue
+			}
+			if err := flags.Set(name, value); err != nil {
+				problems = append(problems, derrors.AsError(err, "invalid setting in configuration file").WithParams(name))
+			}
+		}
+	}
+
+	flags.VisitAll(func(flag *pflag.Flag) {
+		value, exists := os.LookupEnv(cmConfig.EnvName(flag.Name))
+		if !exists {
+			return
+		}
+		if err := flags.Set(flag.Name, value); err != nil {
+			problems = append(problems, derrors.AsError(err, "invalid environment variable").WithParams(cmConfig.EnvName(flag.Name)))
+		}
+	})
+
+	commandLine.Visit(func(flag *pflag.Flag) {
+		if flags.Lookup(flag.Name) == nil {
+			return
+		}
+		if err := flags.Set(flag.Name, flag.Value.String()); err != nil {
+			problems = append(problems, derrors.AsError(err, "invalid flag").WithParams(flag.Name))
+		}
+	})
+
+	parsed, err := policy.ParseOfflinePolicy(offlinePolicy)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	conf.OfflinePolicy = parsed
+	return conf, problems
+}
+
+// logProblems logs each problem of the configuration.
+func logProblems(problems []derrors.Error) {
+	for _, problem := range problems {
+		log.Error().Str("trace", problem.DebugReport()).Msg(problem.Error())
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"github.com/nalej/connectivity-manager/pkg/report"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"os"
+	"strings"
+	"time"
+)
+
+var reportServer string
+var reportOrganizationID string
+var reportClusterID string
+var reportFrom string
+var reportTo string
+var reportPeriod time.Duration
+var reportOutput string
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Generate an uptime report",
+	Long:  `Generate the uptime, number of outages, MTTR and longest outage of the clusters of an organization over a period`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		GenerateReport()
+	},
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportServer, "server", "localhost:8383", "connectivity-manager address (host:port)")
+	reportCmd.Flags().StringVar(&reportOrganizationID, "organizationId", "", "Organization identifier")
+	reportCmd.Flags().StringVar(&reportClusterID, "clusterId", "", "Cluster identifier, all the clusters of the organization if empty")
+	reportCmd.Flags().StringVar(&reportFrom, "from", "", "Beginning of the period (RFC3339), --period before --to if empty")
+	reportCmd.Flags().StringVar(&reportTo, "to", "", "End of the period (RFC3339), now if empty")
+	reportCmd.Flags().DurationVar(&reportPeriod, "period", 7*24*time.Hour, "Duration of the period when --from is not set")
+	reportCmd.Flags().StringVar(&reportOutput, "output", "json", "Output format: json or csv")
+	reportCmd.MarkFlagRequired("organizationId")
+
+	rootCmd.AddCommand(reportCmd)
+}
+
+// parseReportPeriod returns the period of the report as timestamps.
+func parseReportPeriod() (int64, int64, derrors.Error) {
+	to := time.Now()
+	if reportTo != "" {
+		parsed, err := time.Parse(time.RFC3339, reportTo)
+		if err != nil {
+			return 0, 0, derrors.AsError(err, "invalid --to")
+		}
+		to = parsed
+	}
+	from := to.Add(-reportPeriod)
+	if reportFrom != "" {
+		parsed, err := time.Parse(time.RFC3339, reportFrom)
+		if err != nil {
+			return 0, 0, derrors.AsError(err, "invalid --from")
+		}
+		from = parsed
+	}
+	return from.Unix(), to.Unix(), nil
+}
+
+func GenerateReport() {
+	output := strings.ToLower(reportOutput)
+	if output != "json" && output != "csv" {
+		log.Fatal().Str("output", reportOutput).Msg("invalid output format, expecting json or csv")
+	}
+	from, to, pErr := parseReportPeriod()
+	if pErr != nil {
+		log.Fatal().Str("err", pErr.DebugReport()).Msg("invalid report period")
+	}
+
+	conn, err := grpc.Dial(reportServer, grpc.WithInsecure())
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot create connection with connectivity-manager")
+	}
+	defer conn.Close()
+	client := grpc_connectivity_manager_go.NewConnectivityManagerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := client.GetConnectivityReport(ctx, &grpc_connectivity_manager_go.ConnectivityReportRequest{
+		OrganizationId: reportOrganizationID,
+		ClusterId:      reportClusterID,
+		FromTimestamp:  from,
+		ToTimestamp:    to,
+	})
+	if err != nil {
+		log.Fatal().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("cannot generate report")
+	}
+
+	var wErr derrors.Error
+	if output == "csv" {
+		wErr = report.FromGRPC(result).WriteCSV(os.Stdout)
+	} else {
+		wErr = report.FromGRPC(result).WriteJSON(os.Stdout)
+	}
+	if wErr != nil {
+		log.Fatal().Str("err", wErr.DebugReport()).Msg("cannot write report")
+	}
+}
@@ -19,17 +19,17 @@ package commands
 import (
 	"github.com/nalej/connectivity-manager/pkg/server"
 	cmConfig "github.com/nalej/connectivity-manager/pkg/server/config"
-	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/nalej/derrors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
-	"strings"
-	"time"
 )
 
 var config = cmConfig.Config{}
 
 var policyName string
 
+var configFile string
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run connectivity-manager",
@@ -41,28 +41,30 @@ var runCmd = &cobra.Command{
 }
 
 func init() {
-	runCmd.Flags().Uint32Var(&config.Port, "port", 8383, "port where connectivity-manager listens to")
-	runCmd.PersistentFlags().StringVar(&config.SystemModelAddress, "systemModelAddress", "localhost:8800",
-		"System Model address (host:port)")
-	runCmd.Flags().StringVar(&config.QueueAddress, "queueAddress", "", "address of the nalej bus")
-	runCmd.Flags().DurationVar(&config.Threshold, "threshold", time.Minute, "threshold for a cluster to be considered Offline or Online")
-	runCmd.Flags().StringVar(&policyName, "offlinePolicy", "none", "Offline policy to trigger when cordoning an offline cluster: none or drain")
+	bindRunFlags(runCmd.Flags(), &config, &policyName)
+	runCmd.Flags().StringVar(&configFile, "config", "", "YAML file with the settings indexed by their flag name, reloaded on change or on SIGHUP")
 
 	rootCmd.AddCommand(runCmd)
 }
 
 func RunConnectivityManager() {
-
-	policy, exists := grpc_connectivity_manager_go.OfflinePolicy_value[strings.ToUpper(policyName)]
-	if !exists {
-		log.Fatal().Msg("invalid offline policy set")
+	conf, problems := loadConfig(runCmd.Flags(), configFile)
+	problems = append(problems, conf.Problems()...)
+	problems = append(problems, checkConfigFiles(conf)...)
+	if len(problems) > 0 {
+		logProblems(problems)
+		log.Fatal().Int("problems", len(problems)).Msg("invalid configuration")
 	}
-	config.OfflinePolicy = grpc_connectivity_manager_go.OfflinePolicy(policy)
 
 	log.Info().Msg("Launching connectivity-manager!")
-	server, err := server.NewService(&config)
-	if err != nil {
-		log.Fatal().Err(err).Msg("error creating connectivity-manager")
+	server, sErr := server.NewService(conf)
+	if sErr != nil {
+		log.Fatal().Err(sErr).Msg("error creating connectivity-manager")
+	}
+	if configFile != "" {
+		server.WithReloader(configFile, func() (*cmConfig.Config, []derrors.Error) {
+			return loadConfig(runCmd.Flags(), configFile)
+		})
 	}
 	server.Run()
 }
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"golang.org/x/crypto/ed25519"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HMAC signs the cluster alive checks with HMAC-SHA256 and a secret shared with the cluster.
+	HMAC = "hmac-sha256"
+	// Ed25519 signs the cluster alive checks with the private key of the cluster.
+	Ed25519 = "ed25519"
+)
+
+// Reasons to reject a cluster alive check.
+const (
+	Unsigned         = "unsigned"
+	UnknownKey       = "unknown_key"
+	InvalidSignature = "invalid_signature"
+	Replayed         = "replayed"
+	Expired          = "expired"
+	Future           = "future"
+)
+
+// Key of a cluster to verify its cluster alive checks.
+type Key struct {
+	// Algorithm: hmac-sha256 or ed25519.
+	Algorithm string `json:"algorithm"`
+	// Key encoded in base64, the shared secret for hmac-sha256 or the public key for ed25519.
+	Key string `json:"key"`
+}
+
+// Validate checks the algorithm and the encoding of the key.
+func (k Key) Validate() derrors.Error {
+	decoded, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return derrors.AsError(err, "key must be encoded in base64")
+	}
+	switch strings.ToLower(k.Algorithm) {
+	case HMAC:
+		if len(decoded) == 0 {
+			return derrors.NewInvalidArgumentError("hmac key cannot be empty")
+		}
+		return nil
+	case Ed25519:
+		if len(decoded) != ed25519.PublicKeySize {
+			return derrors.NewInvalidArgumentError("invalid ed25519 public key size").WithParams(len(decoded))
+		}
+		return nil
+	}
+	return derrors.NewInvalidArgumentError("invalid algorithm, expecting hmac-sha256 or ed25519").WithParams(k.Algorithm)
+}
+
+// verify checks the signature of a message.
+func (k Key) verify(message []byte, signature string) bool {
+	decodedSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	decodedKey, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(k.Algorithm) {
+	case HMAC:
+		mac := hmac.New(sha256.New, decodedKey)
+		mac.Write(message)
+		return hmac.Equal(mac.Sum(nil), decodedSignature)
+	case Ed25519:
+		return ed25519.Verify(ed25519.PublicKey(decodedKey), message, decodedSignature)
+	}
+	return false
+}
+
+// Keys contains the keys of the clusters.
+type Keys struct {
+	// Clusters indexed by organization identifier and cluster identifier.
+	Clusters map[string]map[string]Key `json:"clusters"`
+}
+
+// LoadKeys reads the keys from a JSON file and validates them.
+func LoadKeys(path string) (*Keys, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read cluster keys file")
+	}
+	keys := &Keys{Clusters: make(map[string]map[string]Key, 0)}
+	if err := json.Unmarshal(content, keys); err != nil {
+		return nil, derrors.AsError(err, "cannot parse cluster keys file")
+	}
+	for organizationID, clusters := range keys.Clusters {
+		for clusterID, key := range clusters {
+			if err := key.Validate(); err != nil {
+				return nil, derrors.NewInvalidArgumentError("invalid cluster key", err).WithParams(organizationID, clusterID)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Message returns the content signed by a cluster alive check.
+func Message(organizationID string, clusterID string, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d", organizationID, clusterID, timestamp))
+}
+
+// SignHMAC returns the signature of a cluster alive check with a shared secret.
+func SignHMAC(secret []byte, organizationID string, clusterID string, timestamp int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(Message(organizationID, clusterID, timestamp))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignEd25519 returns the signature of a cluster alive check with the private key of the cluster.
+func SignEd25519(privateKey ed25519.PrivateKey, organizationID string, clusterID string, timestamp int64) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, Message(organizationID, clusterID, timestamp)))
+}
+
+// Verifier checks the signature of the cluster alive checks and rejects the replayed ones. A check is
+// considered replayed if its timestamp is older than the last accepted one of the cluster, or if it is older
+// than the maximum age. A check with the same timestamp as the last accepted one is left to be dropped as a
+// duplicate, as a cluster may send several checks within a second. The checks dated further in the future
+// than the tolerated clock skew are rejected, as they would block the next checks of the cluster.
+type Verifier struct {
+	sync.Mutex
+	keys   *Keys
+	maxAge time.Duration
+	// maxSkew with the maximum time a check can be dated in the future.
+	maxSkew time.Duration
+	clock   clock.Clock
+	// lastAccepted with the timestamp of the last accepted check per cluster.
+	lastAccepted map[string]int64
+	// pruned with the last time the timestamps older than the maximum age were removed.
+	pruned time.Time
+}
+
+// NewVerifier creates a verifier for a set of keys.
+func NewVerifier(keys *Keys, maxAge time.Duration, maxSkew time.Duration, clock clock.Clock) *Verifier {
+	return &Verifier{
+		keys:         keys,
+		maxAge:       maxAge,
+		maxSkew:      maxSkew,
+		clock:        clock,
+		lastAccepted: make(map[string]int64, 0),
+		pruned:       clock.Now(),
+	}
+}
+
+// SetMaxSkew replaces the maximum time a check can be dated in the future.
+func (v *Verifier) SetMaxSkew(maxSkew time.Duration) {
+	v.Lock()
+	defer v.Unlock()
+	v.maxSkew = maxSkew
+}
+
+// Verify checks a cluster alive check. If it is rejected, the reason is returned with the error.
+func (v *Verifier) Verify(alive *grpc_connectivity_manager_go.ClusterAlive) (string, derrors.Error) {
+	if alive.Signature == "" {
+		return Unsigned, derrors.NewUnauthenticatedError("cluster alive check is not signed").WithParams(alive.OrganizationId, alive.ClusterId)
+	}
+	key, exists := v.keys.Clusters[alive.OrganizationId][alive.ClusterId]
+	if !exists {
+		return UnknownKey, derrors.NewUnauthenticatedError("no key found for the cluster").WithParams(alive.OrganizationId, alive.ClusterId)
+	}
+	if !key.verify(Message(alive.OrganizationId, alive.ClusterId, alive.Timestamp), alive.Signature) {
+		return InvalidSignature, derrors.NewUnauthenticatedError("invalid cluster alive check signature").WithParams(alive.OrganizationId, alive.ClusterId)
+	}
+	now := v.clock.Now()
+	if now.Sub(time.Unix(alive.Timestamp, 0)) > v.maxAge {
+		return Expired, derrors.NewUnauthenticatedError("cluster alive check is too old").WithParams(alive.OrganizationId, alive.ClusterId, alive.Timestamp)
+	}
+	v.Lock()
+	defer v.Unlock()
+	if time.Unix(alive.Timestamp, 0).Sub(now) > v.maxSkew {
+		return Future, derrors.NewUnauthenticatedError("cluster alive check is dated in the future").WithParams(alive.OrganizationId, alive.ClusterId, alive.Timestamp)
+	}
+	v.prune(now)
+	clusterKey := fmt.Sprintf("%s#%s", alive.OrganizationId, alive.ClusterId)
+	if last, exists := v.lastAccepted[clusterKey]; exists && alive.Timestamp < last {
+		return Replayed, derrors.NewUnauthenticatedError("cluster alive check replayed").WithParams(alive.OrganizationId, alive.ClusterId, alive.Timestamp)
+	}
+	v.lastAccepted[clusterKey] = alive.Timestamp
+	return "", nil
+}
+
+// prune removes, once per maximum age, the timestamps older than the maximum age, as the checks they would
+// reject are already expired. It is called with the lock held.
+func (v *Verifier) prune(now time.Time) {
+	if now.Sub(v.pruned) < v.maxAge {
+		return
+	}
+	oldest := now.Add(-v.maxAge).Unix()
+	for clusterKey, last := range v.lastAccepted {
+		if last < oldest {
+			delete(v.lastAccepted, clusterKey)
+		}
+	}
+	v.pruned = now
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authentication
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+var _ = ginkgo.Describe("Cluster alive verification", func() {
+
+	const organizationID = "org"
+	const maxAge = 5 * time.Minute
+	const maxSkew = 30 * time.Second
+
+	secret := []byte("secret")
+
+	var fakeClock *clock.FakeClock
+	var publicKey ed25519.PublicKey
+	var privateKey ed25519.PrivateKey
+	var verifier *Verifier
+
+	signed := func(clusterID string, timestamp int64) *grpc_connectivity_manager_go.ClusterAlive {
+		alive := &grpc_connectivity_manager_go.ClusterAlive{OrganizationId: organizationID, ClusterId: clusterID, Timestamp: timestamp}
+		if clusterID == "ed25519" {
+			alive.Signature = SignEd25519(privateKey, organizationID, clusterID, timestamp)
+		} else {
+			alive.Signature = SignHMAC(secret, organizationID, clusterID, timestamp)
+		}
+		return alive
+	}
+
+	expectRejected := func(alive *grpc_connectivity_manager_go.ClusterAlive, reason string) {
+		rejected, err := verifier.Verify(alive)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(rejected).To(gomega.Equal(reason))
+	}
+
+	expectAccepted := func(alive *grpc_connectivity_manager_go.ClusterAlive) {
+		rejected, err := verifier.Verify(alive)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rejected).To(gomega.BeEmpty())
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		gomega.Expect(err).To(gomega.Succeed())
+		keys := &Keys{Clusters: map[string]map[string]Key{
+			organizationID: {
+				"hmac":    {Algorithm: HMAC, Key: base64.StdEncoding.EncodeToString(secret)},
+				"ed25519": {Algorithm: Ed25519, Key: base64.StdEncoding.EncodeToString(publicKey)},
+			},
+		}}
+		fakeClock = clock.NewFakeClock(time.Unix(1000000, 0))
+		verifier = NewVerifier(keys, maxAge, maxSkew, fakeClock)
+	})
+
+	ginkgo.It("should accept the checks signed with the key of the cluster", func() {
+		expectAccepted(signed("hmac", fakeClock.Now().Unix()))
+		expectAccepted(signed("ed25519", fakeClock.Now().Unix()))
+	})
+
+	ginkgo.It("should reject the checks without a valid signature", func() {
+		alive := signed("hmac", fakeClock.Now().Unix())
+		alive.Signature = ""
+		expectRejected(alive, Unsigned)
+		alive = signed("hmac", fakeClock.Now().Unix())
+		alive.ClusterId = "other"
+		expectRejected(alive, UnknownKey)
+		alive = signed("hmac", fakeClock.Now().Unix())
+		alive.Timestamp++
+		expectRejected(alive, InvalidSignature)
+		alive = signed("ed25519", fakeClock.Now().Unix())
+		alive.Signature = SignHMAC(secret, organizationID, "ed25519", alive.Timestamp)
+		expectRejected(alive, InvalidSignature)
+	})
+
+	ginkgo.It("should reject the checks older than the last accepted one", func() {
+		now := fakeClock.Now().Unix()
+		expectAccepted(signed("hmac", now))
+		expectRejected(signed("hmac", now-1), Replayed)
+		// the replays of a cluster do not affect the others
+		expectAccepted(signed("ed25519", now-1))
+	})
+
+	ginkgo.It("should accept several checks within the same second", func() {
+		now := fakeClock.Now().Unix()
+		expectAccepted(signed("hmac", now))
+		expectAccepted(signed("hmac", now))
+		fakeClock.Advance(time.Second)
+		expectAccepted(signed("hmac", now+1))
+	})
+
+	ginkgo.It("should reject the checks older than the maximum age", func() {
+		expectAccepted(signed("hmac", fakeClock.Now().Add(-maxAge).Unix()))
+		expectRejected(signed("hmac", fakeClock.Now().Add(-maxAge-time.Second).Unix()), Expired)
+	})
+
+	ginkgo.It("should reject the checks dated further in the future than the tolerated skew", func() {
+		expectAccepted(signed("hmac", fakeClock.Now().Add(maxSkew).Unix()))
+		expectRejected(signed("ed25519", fakeClock.Now().Add(maxSkew+time.Second).Unix()), Future)
+		verifier.SetMaxSkew(time.Minute)
+		expectAccepted(signed("ed25519", fakeClock.Now().Add(maxSkew+time.Second).Unix()))
+	})
+
+	ginkgo.It("should forget the timestamps older than the maximum age", func() {
+		expectAccepted(signed("hmac", fakeClock.Now().Unix()))
+		fakeClock.Advance(maxAge + time.Second)
+		expectAccepted(signed("ed25519", fakeClock.Now().Unix()))
+		gomega.Expect(verifier.lastAccepted).To(gomega.HaveLen(1))
+		gomega.Expect(verifier.lastAccepted).To(gomega.HaveKey(organizationID + "#ed25519"))
+	})
+
+	ginkgo.Context("loading the keys", func() {
+
+		ginkgo.It("should validate the keys", func() {
+			gomega.Expect(Key{Algorithm: HMAC, Key: base64.StdEncoding.EncodeToString(secret)}.Validate()).To(gomega.Succeed())
+			gomega.Expect(Key{Algorithm: "ED25519", Key: base64.StdEncoding.EncodeToString(publicKey)}.Validate()).To(gomega.Succeed())
+			gomega.Expect(Key{Algorithm: HMAC, Key: ""}.Validate()).NotTo(gomega.Succeed())
+			gomega.Expect(Key{Algorithm: HMAC, Key: "not base64"}.Validate()).NotTo(gomega.Succeed())
+			gomega.Expect(Key{Algorithm: Ed25519, Key: base64.StdEncoding.EncodeToString(secret)}.Validate()).NotTo(gomega.Succeed())
+			gomega.Expect(Key{Algorithm: "rsa", Key: base64.StdEncoding.EncodeToString(secret)}.Validate()).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should read the keys from a file", func() {
+			file, err := ioutil.TempFile("", "keys")
+			gomega.Expect(err).To(gomega.Succeed())
+			defer os.Remove(file.Name())
+			_, err = file.WriteString(`{"clusters": {"org": {"hmac": {"algorithm": "hmac-sha256", "key": "c2VjcmV0"}}}}`)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(file.Close()).To(gomega.Succeed())
+
+			keys, lErr := LoadKeys(file.Name())
+			gomega.Expect(lErr).To(gomega.Succeed())
+			gomega.Expect(keys.Clusters[organizationID]["hmac"].Key).To(gomega.Equal(base64.StdEncoding.EncodeToString(secret)))
+		})
+
+		ginkgo.It("should reject a file with an invalid key", func() {
+			file, err := ioutil.TempFile("", "keys")
+			gomega.Expect(err).To(gomega.Succeed())
+			defer os.Remove(file.Name())
+			_, err = file.WriteString(`{"clusters": {"org": {"hmac": {"algorithm": "hmac-sha256", "key": ""}}}}`)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(file.Close()).To(gomega.Succeed())
+
+			_, lErr := LoadKeys(file.Name())
+			gomega.Expect(lErr).NotTo(gomega.Succeed())
+		})
+	})
+})
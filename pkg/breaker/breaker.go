@@ -0,0 +1,196 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MinOffline with the number of clusters that must go offline within the window for the percentage to be
+// considered, so a single offline cluster of a small installation does not open the breaker.
+const MinOffline = 2
+
+// Suppressed is a cluster whose offline policy was not triggered while the breaker was open.
+type Suppressed struct {
+	OrganizationId string
+	ClusterId      string
+	Timestamp      time.Time
+}
+
+// Status of the breaker.
+type Status struct {
+	// Open is true if the offline policies are suppressed.
+	Open bool
+	// Since with the time the breaker opened.
+	Since time.Time
+	// Reason why the breaker opened.
+	Reason string
+	// Offline with the number of clusters that went offline within the window.
+	Offline int
+	// Total with the number of clusters of the last sweep.
+	Total int
+	// Suppressed with the clusters whose offline policy was suppressed.
+	Suppressed []Suppressed
+}
+
+// Breaker suppresses the offline policies when too many clusters go offline at once, as it is more likely
+// that the management cluster has lost its connectivity than the clusters. Once open, the breaker remains
+// open until it is released by an operator.
+type Breaker struct {
+	sync.Mutex
+	// count with the number of clusters going offline within the window that opens the breaker, zero to disable.
+	count int
+	// percentage of the clusters going offline within the window that opens the breaker, zero to disable.
+	percentage float64
+	window     time.Duration
+	// offline with the time each cluster went offline within the window.
+	offline map[string]time.Time
+	total   int
+	status  Status
+}
+
+// NewBreaker creates a closed breaker.
+func NewBreaker(count int, percentage float64, window time.Duration) *Breaker {
+	return &Breaker{
+		count:      count,
+		percentage: percentage,
+		window:     window,
+		offline:    make(map[string]time.Time, 0),
+		status:     Status{Suppressed: make([]Suppressed, 0)},
+	}
+}
+
+// SetLimits replaces the limits that open the breaker, applied from the next cluster going offline.
+func (b *Breaker) SetLimits(count int, percentage float64, window time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	b.count = count
+	b.percentage = percentage
+	b.window = window
+}
+
+// SetTotal sets the number of clusters the percentage is computed on.
+func (b *Breaker) SetTotal(total int) {
+	b.Lock()
+	defer b.Unlock()
+	b.total = total
+}
+
+// Offline records a cluster going offline and returns true if it opens the breaker.
+func (b *Breaker) Offline(key string, now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	for other, since := range b.offline {
+		if now.Sub(since) > b.window {
+			delete(b.offline, other)
+		}
+	}
+	b.offline[key] = now
+	if b.status.Open {
+		return false
+	}
+	offline := len(b.offline)
+	switch {
+	case b.count > 0 && offline > b.count:
+		b.open(now, fmt.Sprintf("%d clusters offline within %s", offline, b.window))
+		return true
+	case b.percentage > 0 && offline >= MinOffline && b.total > 0 && float64(offline)*100/float64(b.total) > b.percentage:
+		b.open(now, fmt.Sprintf("%d of %d clusters offline within %s", offline, b.total, b.window))
+		return true
+	}
+	return false
+}
+
+func (b *Breaker) open(now time.Time, reason string) {
+	b.status.Open = true
+	b.status.Since = now
+	b.status.Reason = reason
+}
+
+// Allow returns true if the offline policies can be triggered. Otherwise, the cluster is recorded as suppressed.
+func (b *Breaker) Allow(organizationID string, clusterID string, now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	if !b.status.Open {
+		return true
+	}
+	suppressed := Suppressed{
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		Timestamp:      now,
+	}
+	for index, previous := range b.status.Suppressed {
+		if previous.OrganizationId == organizationID && previous.ClusterId == clusterID {
+			b.status.Suppressed[index] = suppressed
+			return false
+		}
+	}
+	b.status.Suppressed = append(b.status.Suppressed, suppressed)
+	return false
+}
+
+// Release closes the breaker, forgetting the clusters that went offline, and returns the suppressed clusters.
+func (b *Breaker) Release() []Suppressed {
+	b.Lock()
+	defer b.Unlock()
+	suppressed := b.status.Suppressed
+	b.offline = make(map[string]time.Time, 0)
+	b.status = Status{Suppressed: make([]Suppressed, 0)}
+	return suppressed
+}
+
+// State returns the state of the breaker to persist.
+func (b *Breaker) State() State {
+	b.Lock()
+	defer b.Unlock()
+	return State{
+		Open:       b.status.Open,
+		Since:      b.status.Since,
+		Reason:     b.status.Reason,
+		Suppressed: append(make([]Suppressed, 0, len(b.status.Suppressed)), b.status.Suppressed...),
+	}
+}
+
+// Restore a persisted state, forgetting the clusters that went offline.
+func (b *Breaker) Restore(state State) {
+	b.Lock()
+	defer b.Unlock()
+	b.offline = make(map[string]time.Time, 0)
+	b.status = Status{
+		Open:       state.Open,
+		Since:      state.Since,
+		Reason:     state.Reason,
+		Suppressed: append(make([]Suppressed, 0, len(state.Suppressed)), state.Suppressed...),
+	}
+}
+
+// Status returns the current status of the breaker.
+func (b *Breaker) Status(now time.Time) Status {
+	b.Lock()
+	defer b.Unlock()
+	result := b.status
+	result.Suppressed = append(make([]Suppressed, 0, len(b.status.Suppressed)), b.status.Suppressed...)
+	result.Total = b.total
+	for _, since := range b.offline {
+		if now.Sub(since) <= b.window {
+			result.Offline++
+		}
+	}
+	return result
+}
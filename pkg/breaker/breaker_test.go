@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package breaker
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Drain breaker", func() {
+
+	const window = time.Minute
+
+	var start time.Time
+
+	ginkgo.BeforeEach(func() {
+		start = time.Unix(1000000, 0)
+	})
+
+	ginkgo.Context("with a count", func() {
+
+		ginkgo.It("should open when the count is exceeded within the window", func() {
+			b := NewBreaker(3, 0, window)
+			gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("b", start.Add(10*time.Second))).To(gomega.BeFalse())
+			gomega.Expect(b.Allow("org", "b", start.Add(10*time.Second))).To(gomega.BeTrue())
+			// reaching the count is not enough
+			gomega.Expect(b.Offline("c", start.Add(20*time.Second))).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("d", start.Add(30*time.Second))).To(gomega.BeTrue())
+			status := b.Status(start.Add(30 * time.Second))
+			gomega.Expect(status.Open).To(gomega.BeTrue())
+			gomega.Expect(status.Since).To(gomega.Equal(start.Add(30 * time.Second)))
+			gomega.Expect(status.Offline).To(gomega.Equal(4))
+			gomega.Expect(status.Reason).NotTo(gomega.BeEmpty())
+			// already open
+			gomega.Expect(b.Offline("e", start.Add(40*time.Second))).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("should not count the clusters outside the window", func() {
+			b := NewBreaker(2, 0, window)
+			gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("b", start.Add(30*time.Second))).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("c", start.Add(window+time.Second))).To(gomega.BeFalse())
+			gomega.Expect(b.Status(start.Add(window + time.Second)).Offline).To(gomega.Equal(2))
+			gomega.Expect(b.Offline("d", start.Add(window+2*time.Second))).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should count a cluster once", func() {
+			b := NewBreaker(1, 0, window)
+			gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("a", start.Add(time.Second))).To(gomega.BeFalse())
+			gomega.Expect(b.Status(start.Add(time.Second)).Open).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("with a percentage", func() {
+
+		ginkgo.It("should open when the percentage of the total is exceeded", func() {
+			b := NewBreaker(0, 30, window)
+			b.SetTotal(10)
+			gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("b", start)).To(gomega.BeFalse())
+			// reaching the percentage is not enough
+			gomega.Expect(b.Offline("c", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("d", start)).To(gomega.BeTrue())
+			status := b.Status(start)
+			gomega.Expect(status.Open).To(gomega.BeTrue())
+			gomega.Expect(status.Total).To(gomega.Equal(10))
+		})
+
+		ginkgo.It("should require the minimum number of offline clusters", func() {
+			b := NewBreaker(0, 30, window)
+			b.SetTotal(2)
+			gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("b", start)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should not open without the total", func() {
+			b := NewBreaker(0, 30, window)
+			gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+			gomega.Expect(b.Offline("b", start)).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.It("should never open when disabled", func() {
+		b := NewBreaker(0, 0, window)
+		b.SetTotal(2)
+		gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+		gomega.Expect(b.Offline("b", start)).To(gomega.BeFalse())
+		gomega.Expect(b.Allow("org", "a", start)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should apply the new limits", func() {
+		b := NewBreaker(0, 0, window)
+		gomega.Expect(b.Offline("a", start)).To(gomega.BeFalse())
+		b.SetLimits(1, 0, window)
+		gomega.Expect(b.Offline("b", start)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should record the suppressed clusters once and return them on release", func() {
+		b := NewBreaker(1, 0, window)
+		gomega.Expect(b.Offline("x", start)).To(gomega.BeFalse())
+		gomega.Expect(b.Offline("a", start)).To(gomega.BeTrue())
+		gomega.Expect(b.Allow("org", "a", start)).To(gomega.BeFalse())
+		gomega.Expect(b.Allow("org", "b", start.Add(time.Second))).To(gomega.BeFalse())
+		gomega.Expect(b.Allow("org", "a", start.Add(2*time.Second))).To(gomega.BeFalse())
+		suppressed := b.Release()
+		gomega.Expect(suppressed).To(gomega.Equal([]Suppressed{
+			{OrganizationId: "org", ClusterId: "a", Timestamp: start.Add(2 * time.Second)},
+			{OrganizationId: "org", ClusterId: "b", Timestamp: start.Add(time.Second)},
+		}))
+		status := b.Status(start.Add(3 * time.Second))
+		gomega.Expect(status.Open).To(gomega.BeFalse())
+		gomega.Expect(status.Offline).To(gomega.Equal(0))
+		gomega.Expect(status.Suppressed).To(gomega.BeEmpty())
+		gomega.Expect(b.Allow("org", "a", start.Add(3*time.Second))).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should restore a persisted state", func() {
+		b := NewBreaker(1, 0, window)
+		gomega.Expect(b.Offline("x", start)).To(gomega.BeFalse())
+		gomega.Expect(b.Offline("a", start)).To(gomega.BeTrue())
+		gomega.Expect(b.Allow("org", "a", start)).To(gomega.BeFalse())
+		store := NewMemoryStore()
+		gomega.Expect(store.Save(b.State())).To(gomega.Succeed())
+
+		state, err := store.Load()
+		gomega.Expect(err).To(gomega.Succeed())
+		restored := NewBreaker(1, 0, window)
+		restored.Restore(*state)
+		status := restored.Status(start)
+		gomega.Expect(status.Open).To(gomega.BeTrue())
+		gomega.Expect(status.Since).To(gomega.Equal(start))
+		gomega.Expect(status.Reason).To(gomega.Equal(b.Status(start).Reason))
+		gomega.Expect(status.Suppressed).To(gomega.HaveLen(1))
+		// the clusters counted within the window are not restored
+		gomega.Expect(status.Offline).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should load a closed breaker from an empty memory store", func() {
+		state, err := NewMemoryStore().Load()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(state.Open).To(gomega.BeFalse())
+		gomega.Expect(state.Suppressed).To(gomega.BeEmpty())
+	})
+})
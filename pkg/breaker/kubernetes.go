@@ -0,0 +1,107 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package breaker
+
+import (
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigMapStateKey with the key of the ConfigMap data holding the state.
+const ConfigMapStateKey = "state"
+
+// ConfigMapStore keeps the state in a Kubernetes ConfigMap, so it survives the restarts and the leader
+// handovers.
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStore creates a store on a ConfigMap of the cluster the component is running on. The ConfigMap
+// is created on the first save.
+func NewConfigMapStore(namespace string, name string) (*ConfigMapStore, derrors.Error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot load the in-cluster Kubernetes configuration")
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create the Kubernetes client")
+	}
+	return &ConfigMapStore{client: client, namespace: namespace, name: name}, nil
+}
+
+// Load the last state saved.
+func (s *ConfigMapStore) Load() (*State, derrors.Error) {
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &State{Suppressed: make([]Suppressed, 0)}, nil
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read drain breaker state")
+	}
+	value, exists := configMap.Data[ConfigMapStateKey]
+	if !exists {
+		return &State{Suppressed: make([]Suppressed, 0)}, nil
+	}
+	state := &State{}
+	if err := json.Unmarshal([]byte(value), state); err != nil {
+		return nil, derrors.AsError(err, "cannot unmarshal drain breaker state")
+	}
+	if state.Suppressed == nil {
+		state.Suppressed = make([]Suppressed, 0)
+	}
+	return state, nil
+}
+
+// Save a state, retrying on conflicts.
+func (s *ConfigMapStore) Save(state State) derrors.Error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return derrors.AsError(err, "cannot marshal drain breaker state")
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+			configMap.Data = map[string]string{ConfigMapStateKey: string(value)}
+			_, err = configMaps.Create(configMap)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string, 0)
+		}
+		configMap.Data[ConfigMapStateKey] = string(value)
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot save drain breaker state")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package breaker
+
+import (
+	"github.com/nalej/derrors"
+	"sync"
+	"time"
+)
+
+// State of the breaker that is persisted, so a new leader keeps it open with the suppressed clusters. The
+// clusters counted within the window are not persisted, the count starts again with the new leader.
+type State struct {
+	Open       bool         `json:"open"`
+	Since      time.Time    `json:"since"`
+	Reason     string       `json:"reason"`
+	Suppressed []Suppressed `json:"suppressed"`
+}
+
+// Store persists the state of the breaker.
+type Store interface {
+	// Load the last state saved, a closed breaker if none.
+	Load() (*State, derrors.Error)
+	// Save a state, replacing the previous one.
+	Save(state State) derrors.Error
+}
+
+// MemoryStore keeps the state in memory, so it is lost on restart.
+type MemoryStore struct {
+	sync.Mutex
+	state State
+}
+
+// NewMemoryStore creates a store with a closed breaker.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: State{Suppressed: make([]Suppressed, 0)}}
+}
+
+// Load the last state saved.
+func (s *MemoryStore) Load() (*State, derrors.Error) {
+	s.Lock()
+	defer s.Unlock()
+	state := s.state
+	state.Suppressed = append(make([]Suppressed, 0, len(s.state.Suppressed)), s.state.Suppressed...)
+	return &state, nil
+}
+
+// Save a state.
+func (s *MemoryStore) Save(state State) derrors.Error {
+	s.Lock()
+	defer s.Unlock()
+	s.state = state
+	return nil
+}
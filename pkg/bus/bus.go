@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bus
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/nalej/nalej-bus/pkg/queue/infrastructure/events"
+)
+
+// Producer interface for the queues the component sends messages to.
+type Producer interface {
+	// Send a message to the queue.
+	Send(ctx context.Context, msg proto.Message) derrors.Error
+}
+
+// ClusterAliveConsumer interface for the queue the component receives the cluster alive checks from.
+type ClusterAliveConsumer interface {
+	// Consume receives the next message of the queue and dispatches it to its channel.
+	Consume(ctx context.Context) derrors.Error
+	// ClusterAlive returns the channel where the cluster alive checks are dispatched.
+	ClusterAlive() <-chan *grpc_connectivity_manager_go.ClusterAlive
+}
+
+// infrastructureEventsConsumer adapts the nalej bus infrastructure events consumer.
+type infrastructureEventsConsumer struct {
+	consumer *events.InfrastructureEventsConsumer
+}
+
+// NewInfrastructureEventsConsumer wraps a nalej bus infrastructure events consumer.
+func NewInfrastructureEventsConsumer(consumer *events.InfrastructureEventsConsumer) ClusterAliveConsumer {
+	return &infrastructureEventsConsumer{consumer: consumer}
+}
+
+func (c *infrastructureEventsConsumer) Consume(ctx context.Context) derrors.Error {
+	return c.consumer.Consume(ctx)
+}
+
+func (c *infrastructureEventsConsumer) ClusterAlive() <-chan *grpc_connectivity_manager_go.ClusterAlive {
+	return c.consumer.Config.ChClusterAlive
+}
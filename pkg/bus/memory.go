@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bus
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"sync"
+)
+
+const (
+	// MemoryQueueSize is the number of messages that can be pending on the in-memory queues.
+	MemoryQueueSize = 1000
+)
+
+// MemoryBus is an in-memory implementation of the queues used by the component, intended for tests.
+type MemoryBus struct {
+	sync.Mutex
+	incoming     chan *grpc_connectivity_manager_go.ClusterAlive
+	clusterAlive chan *grpc_connectivity_manager_go.ClusterAlive
+	ops          []proto.Message
+	events       []proto.Message
+}
+
+// NewMemoryBus creates an empty in-memory bus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		incoming:     make(chan *grpc_connectivity_manager_go.ClusterAlive, MemoryQueueSize),
+		clusterAlive: make(chan *grpc_connectivity_manager_go.ClusterAlive, MemoryQueueSize),
+		ops:          make([]proto.Message, 0),
+		events:       make([]proto.Message, 0),
+	}
+}
+
+// PublishClusterAlive sends a cluster alive check to the infrastructure events queue.
+func (b *MemoryBus) PublishClusterAlive(alive *grpc_connectivity_manager_go.ClusterAlive) {
+	b.incoming <- alive
+}
+
+// OpsProducer returns a producer for the infrastructure ops queue.
+func (b *MemoryBus) OpsProducer() Producer {
+	return &memoryProducer{bus: b, queue: &b.ops}
+}
+
+// EventsProducer returns a producer for the infrastructure events queue.
+func (b *MemoryBus) EventsProducer() Producer {
+	return &memoryProducer{bus: b, queue: &b.events}
+}
+
+// EventsConsumer returns a consumer of the cluster alive checks of the infrastructure events queue.
+func (b *MemoryBus) EventsConsumer() ClusterAliveConsumer {
+	return &memoryConsumer{bus: b}
+}
+
+// OpsMessages returns the messages sent to the infrastructure ops queue.
+func (b *MemoryBus) OpsMessages() []proto.Message {
+	b.Lock()
+	defer b.Unlock()
+	return append([]proto.Message{}, b.ops...)
+}
+
+// EventsMessages returns the messages sent to the infrastructure events queue.
+func (b *MemoryBus) EventsMessages() []proto.Message {
+	b.Lock()
+	defer b.Unlock()
+	return append([]proto.Message{}, b.events...)
+}
+
+// Clear removes the messages sent to the queues.
+func (b *MemoryBus) Clear() {
+	b.Lock()
+	defer b.Unlock()
+	b.ops = make([]proto.Message, 0)
+	b.events = make([]proto.Message, 0)
+}
+
+type memoryProducer struct {
+	bus   *MemoryBus
+	queue *[]proto.Message
+}
+
+func (p *memoryProducer) Send(ctx context.Context, msg proto.Message) derrors.Error {
+	p.bus.Lock()
+	defer p.bus.Unlock()
+	*p.queue = append(*p.queue, proto.Clone(msg))
+	return nil
+}
+
+type memoryConsumer struct {
+	bus *MemoryBus
+}
+
+func (c *memoryConsumer) Consume(ctx context.Context) derrors.Error {
+	select {
+	case alive := <-c.bus.incoming:
+		select {
+		case c.bus.clusterAlive <- alive:
+		case <-ctx.Done():
+		}
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func (c *memoryConsumer) ClusterAlive() <-chan *grpc_connectivity_manager_go.ClusterAlive {
+	return c.bus.clusterAlive
+}
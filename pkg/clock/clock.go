@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock interface for all the timing decisions of the component.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a ticker that delivers ticks with the given period.
+	NewTicker(period time.Duration) Ticker
+}
+
+// Ticker interface that mimics time.Ticker.
+type Ticker interface {
+	// C returns the channel where the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// realClock relies on the time package.
+type realClock struct{}
+
+// New returns a clock backed by the system time.
+func New() Clock {
+	return &realClock{}
+}
+
+func (c *realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *realClock) NewTicker(period time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(period)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// FakeClock is a clock that only moves when it is advanced, intended for tests.
+type FakeClock struct {
+	sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFakeClock creates a fake clock set at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{
+		now:     start,
+		tickers: make([]*fakeTicker, 0),
+	}
+}
+
+// Now returns the current time of the fake clock.
+func (c *FakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker that fires when the fake clock is advanced past each period.
+func (c *FakeClock) NewTicker(period time.Duration) Ticker {
+	c.Lock()
+	defer c.Unlock()
+	ticker := &fakeTicker{
+		clock:  c,
+		period: period,
+		next:   c.now.Add(period),
+		ch:     make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the fake clock forward, firing the tickers whose period has elapsed. As with time.Ticker,
+// ticks are dropped if the receiver does not keep up.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	for _, ticker := range c.tickers {
+		for !ticker.next.After(c.now) {
+			select {
+			case ticker.ch <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+func (c *FakeClock) remove(ticker *fakeTicker) {
+	c.Lock()
+	defer c.Unlock()
+	for index, t := range c.tickers {
+		if t == ticker {
+			c.tickers = append(c.tickers[:index], c.tickers[index+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.remove(t)
+}
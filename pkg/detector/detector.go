@@ -0,0 +1,88 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package detector
+
+import (
+	"github.com/nalej/derrors"
+	"strings"
+	"time"
+)
+
+const (
+	// Threshold detector name.
+	Threshold = "threshold"
+	// PhiAccrual detector name.
+	PhiAccrual = "phi"
+)
+
+// Detector interface for the failure detectors that decide when a cluster must be considered offline.
+type Detector interface {
+	// Heartbeat records the arrival of a cluster alive check.
+	Heartbeat(key string, arrival time.Time)
+	// Expired returns true if a cluster whose last alive check arrived at lastAlive must be considered offline.
+	// The threshold is the fixed limit configured for the cluster.
+	Expired(key string, lastAlive time.Time, now time.Time, threshold time.Duration) bool
+	// Deadline returns the earliest time at which a cluster whose last alive check arrived at lastAlive
+	// would be considered offline.
+	Deadline(key string, lastAlive time.Time, threshold time.Duration) time.Time
+	// Forget removes the information stored for a cluster.
+	Forget(key string)
+}
+
+// ValidDetector checks that the name of a detector is supported.
+func ValidDetector(name string) derrors.Error {
+	switch strings.ToLower(name) {
+	case Threshold, PhiAccrual:
+		return nil
+	}
+	return derrors.NewInvalidArgumentError("invalid detector, expecting threshold or phi").WithParams(name)
+}
+
+// NewDetector creates a detector by name.
+func NewDetector(name string, phiThreshold float64) (Detector, derrors.Error) {
+	if err := ValidDetector(name); err != nil {
+		return nil, err
+	}
+	if strings.ToLower(name) == PhiAccrual {
+		return NewPhiAccrualDetector(phiThreshold), nil
+	}
+	return NewThresholdDetector(), nil
+}
+
+// ThresholdDetector considers a cluster offline when its last alive check is older than a fixed threshold.
+type ThresholdDetector struct{}
+
+// NewThresholdDetector creates a new fixed threshold detector.
+func NewThresholdDetector() *ThresholdDetector {
+	return &ThresholdDetector{}
+}
+
+// Heartbeat is a no-op as the threshold detector does not learn from the arrivals.
+func (d *ThresholdDetector) Heartbeat(key string, arrival time.Time) {}
+
+// Expired returns true if the elapsed time since the last alive check is greater than the threshold.
+func (d *ThresholdDetector) Expired(key string, lastAlive time.Time, now time.Time, threshold time.Duration) bool {
+	return int64(now.Sub(lastAlive).Seconds()) > int64(threshold.Seconds())
+}
+
+// Deadline returns the first second at which the elapsed time is greater than the threshold.
+func (d *ThresholdDetector) Deadline(key string, lastAlive time.Time, threshold time.Duration) time.Time {
+	return lastAlive.Add(threshold.Truncate(time.Second) + time.Second)
+}
+
+// Forget is a no-op as the threshold detector does not store information per cluster.
+func (d *ThresholdDetector) Forget(key string) {}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package detector
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPhiThreshold is the suspicion level over which a cluster is considered offline.
+	DefaultPhiThreshold = 8.0
+	// MaxSamples is the number of inter-arrival intervals kept per cluster.
+	MaxSamples = 200
+	// MinSamples is the number of inter-arrival intervals required before trusting the estimation.
+	MinSamples = 5
+	// MinStdDeviation avoids infinite suspicion levels when heartbeats arrive with a perfect period.
+	MinStdDeviation = 500 * time.Millisecond
+)
+
+// heartbeatHistory contains a sliding window of inter-arrival intervals in milliseconds.
+type heartbeatHistory struct {
+	lastArrival time.Time
+	intervals   []float64
+	next        int
+	sum         float64
+	squaredSum  float64
+}
+
+func (h *heartbeatHistory) add(interval float64) {
+	if len(h.intervals) < MaxSamples {
+		h.intervals = append(h.intervals, interval)
+	} else {
+		dropped := h.intervals[h.next]
+		h.sum -= dropped
+		h.squaredSum -= dropped * dropped
+		h.intervals[h.next] = interval
+		h.next = (h.next + 1) % MaxSamples
+	}
+	h.sum += interval
+	h.squaredSum += interval * interval
+}
+
+func (h *heartbeatHistory) mean() float64 {
+	return h.sum / float64(len(h.intervals))
+}
+
+func (h *heartbeatHistory) stdDeviation() float64 {
+	mean := h.mean()
+	variance := h.squaredSum/float64(len(h.intervals)) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return math.Sqrt(variance)
+}
+
+// PhiAccrualDetector learns the distribution of the heartbeat inter-arrival times of each cluster and
+// computes a suspicion level (phi) on the elapsed time since the last alive check. See Hayashibara et al.,
+// "The phi accrual failure detector". Clusters without enough samples fall back to the fixed threshold.
+type PhiAccrualDetector struct {
+	sync.Mutex
+	phiThreshold float64
+	fallback     *ThresholdDetector
+	history      map[string]*heartbeatHistory
+}
+
+// NewPhiAccrualDetector creates a new phi accrual detector.
+func NewPhiAccrualDetector(phiThreshold float64) *PhiAccrualDetector {
+	if phiThreshold <= 0 {
+		phiThreshold = DefaultPhiThreshold
+	}
+	return &PhiAccrualDetector{
+		phiThreshold: phiThreshold,
+		fallback:     NewThresholdDetector(),
+		history:      make(map[string]*heartbeatHistory, 0),
+	}
+}
+
+// Heartbeat records the arrival of a cluster alive check.
+func (d *PhiAccrualDetector) Heartbeat(key string, arrival time.Time) {
+	d.Lock()
+	defer d.Unlock()
+	h, exists := d.history[key]
+	if !exists {
+		d.history[key] = &heartbeatHistory{lastArrival: arrival}
+		return
+	}
+	if !arrival.After(h.lastArrival) {
+		return
+	}
+	h.add(float64(arrival.Sub(h.lastArrival)) / float64(time.Millisecond))
+	h.lastArrival = arrival
+}
+
+// Phi returns the suspicion level of a cluster. The second value is false if there are not enough samples.
+func (d *PhiAccrualDetector) Phi(key string, lastAlive time.Time, now time.Time) (float64, bool) {
+	d.Lock()
+	defer d.Unlock()
+	h, exists := d.history[key]
+	if !exists || len(h.intervals) < MinSamples {
+		return 0, false
+	}
+	elapsed := float64(now.Sub(lastAlive)) / float64(time.Millisecond)
+	stdDeviation := math.Max(h.stdDeviation(), float64(MinStdDeviation)/float64(time.Millisecond))
+	return phi(elapsed, h.mean(), stdDeviation), true
+}
+
+// Expired returns true if the suspicion level of the cluster is over the phi threshold.
+func (d *PhiAccrualDetector) Expired(key string, lastAlive time.Time, now time.Time, threshold time.Duration) bool {
+	value, ok := d.Phi(key, lastAlive, now)
+	if !ok {
+		return d.fallback.Expired(key, lastAlive, now, threshold)
+	}
+	return value > d.phiThreshold
+}
+
+// Deadline returns the time at which the suspicion level of the cluster goes over the phi threshold, with a
+// millisecond precision.
+func (d *PhiAccrualDetector) Deadline(key string, lastAlive time.Time, threshold time.Duration) time.Time {
+	d.Lock()
+	h, exists := d.history[key]
+	if !exists || len(h.intervals) < MinSamples {
+		d.Unlock()
+		return d.fallback.Deadline(key, lastAlive, threshold)
+	}
+	mean := h.mean()
+	stdDeviation := math.Max(h.stdDeviation(), float64(MinStdDeviation)/float64(time.Millisecond))
+	d.Unlock()
+	// phi grows with the elapsed time, look for an upper bound and bisect
+	low, high := 0.0, math.Max(mean, 1.0)
+	for phi(high, mean, stdDeviation) <= d.phiThreshold {
+		low = high
+		high *= 2
+	}
+	for high-low > 1 {
+		middle := (low + high) / 2
+		if phi(middle, mean, stdDeviation) > d.phiThreshold {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	return lastAlive.Add(time.Duration(math.Ceil(high)) * time.Millisecond)
+}
+
+// Forget removes the heartbeat history of a cluster.
+func (d *PhiAccrualDetector) Forget(key string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.history, key)
+}
+
+// phi computes -log10(1 - F(elapsed)) where F is the cumulative distribution function of a normal
+// distribution, using the logistic approximation of the CDF.
+func phi(elapsed float64, mean float64, stdDeviation float64) float64 {
+	y := (elapsed - mean) / stdDeviation
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1.0 + e))
+	}
+	return -math.Log10(1.0 - 1.0/(1.0+e))
+}
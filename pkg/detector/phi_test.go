@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package detector
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Phi accrual detector", func() {
+
+	const key = "org#cluster"
+	const threshold = time.Minute
+
+	var start time.Time
+	var detector *PhiAccrualDetector
+
+	// heartbeats records a number of arrivals with a fixed period and returns the last one.
+	heartbeats := func(count int, period time.Duration) time.Time {
+		arrival := start
+		for index := 0; index < count; index++ {
+			arrival = start.Add(time.Duration(index) * period)
+			detector.Heartbeat(key, arrival)
+		}
+		return arrival
+	}
+
+	ginkgo.BeforeEach(func() {
+		start = time.Unix(1000000, 0)
+		detector = NewPhiAccrualDetector(DefaultPhiThreshold)
+	})
+
+	ginkgo.It("should fall back to the threshold without enough samples", func() {
+		last := heartbeats(MinSamples, 10*time.Second)
+		_, ok := detector.Phi(key, last, last.Add(time.Second))
+		gomega.Expect(ok).To(gomega.BeFalse())
+		gomega.Expect(detector.Expired(key, last, last.Add(threshold), threshold)).To(gomega.BeFalse())
+		gomega.Expect(detector.Expired(key, last, last.Add(threshold+time.Second), threshold)).To(gomega.BeTrue())
+		gomega.Expect(detector.Deadline(key, last, threshold)).To(gomega.Equal(last.Add(threshold + time.Second)))
+	})
+
+	ginkgo.It("should grow the suspicion level with the elapsed time", func() {
+		last := heartbeats(MinSamples+1, 10*time.Second)
+		previous := 0.0
+		for elapsed := time.Duration(0); elapsed <= 30*time.Second; elapsed += time.Second {
+			value, ok := detector.Phi(key, last, last.Add(elapsed))
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(value).To(gomega.BeNumerically(">=", previous))
+			previous = value
+		}
+		gomega.Expect(previous).To(gomega.BeNumerically(">", DefaultPhiThreshold))
+	})
+
+	ginkgo.It("should expire a cluster once its heartbeats are overdue for its period", func() {
+		last := heartbeats(20, 10*time.Second)
+		gomega.Expect(detector.Expired(key, last, last.Add(10*time.Second), threshold)).To(gomega.BeFalse())
+		gomega.Expect(detector.Expired(key, last, last.Add(20*time.Second), threshold)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should return the time over the phi threshold as deadline with a millisecond precision", func() {
+		last := heartbeats(20, 10*time.Second)
+		deadline := detector.Deadline(key, last, threshold)
+		gomega.Expect(deadline.After(last.Add(10 * time.Second))).To(gomega.BeTrue())
+		gomega.Expect(deadline.Before(last.Add(threshold))).To(gomega.BeTrue())
+		gomega.Expect(detector.Expired(key, last, deadline, threshold)).To(gomega.BeTrue())
+		gomega.Expect(detector.Expired(key, last, deadline.Add(-2*time.Millisecond), threshold)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should ignore the arrivals out of order", func() {
+		last := heartbeats(MinSamples+1, 10*time.Second)
+		detector.Heartbeat(key, last.Add(-5*time.Second))
+		detector.Heartbeat(key, last)
+		value, ok := detector.Phi(key, last, last.Add(10*time.Second))
+		gomega.Expect(ok).To(gomega.BeTrue())
+		expected := phi(10000, 10000, float64(MinStdDeviation)/float64(time.Millisecond))
+		gomega.Expect(value).To(gomega.BeNumerically("~", expected, 1e-9))
+	})
+
+	ginkgo.It("should keep at most the maximum number of samples", func() {
+		heartbeats(MaxSamples+1, time.Second)
+		last := heartbeats(MaxSamples*2, 10*time.Second)
+		gomega.Expect(detector.history[key].intervals).To(gomega.HaveLen(MaxSamples))
+		// the intervals of one second have been replaced
+		gomega.Expect(detector.history[key].mean()).To(gomega.BeNumerically("~", 10000, 1e-6))
+		gomega.Expect(detector.Expired(key, last, last.Add(5*time.Second), threshold)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should forget the history of a cluster", func() {
+		last := heartbeats(20, 10*time.Second)
+		detector.Forget(key)
+		_, ok := detector.Phi(key, last, last)
+		gomega.Expect(ok).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should create the detectors by name", func() {
+		created, err := NewDetector("PHI", 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(created.(*PhiAccrualDetector).phiThreshold).To(gomega.Equal(DefaultPhiThreshold))
+		created, err = NewDetector(Threshold, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(created).To(gomega.BeAssignableToTypeOf(&ThresholdDetector{}))
+		_, err = NewDetector("other", 0)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package drain
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StateLabel of the clusters with the state of their drain, so a new leader can queue again the drains
+	// that were not sent.
+	StateLabel = "connectivity-manager.nalej.com/drain"
+	// PendingState of a cluster whose drain is queued.
+	PendingState = "pending"
+	// SentState of a cluster whose drain has been sent.
+	SentState = "sent"
+	// RetryBackoff with the wait before sending again a drain that could not be sent, doubled after each failure.
+	RetryBackoff = 10 * time.Second
+	// MaxRetryBackoff with the maximum wait before sending again a drain.
+	MaxRetryBackoff = 5 * time.Minute
+)
+
+// Drain request of a cluster.
+type Drain struct {
+	OrganizationId string
+	ClusterId      string
+	// Enqueued with the time the drain was requested.
+	Enqueued time.Time
+	// Sent with the time the drain was sent to the bus, zero while pending.
+	Sent time.Time
+	// Failures with the number of failed attempts to send the drain.
+	Failures int
+	// NotBefore with the time the drain can be sent again after a failure.
+	NotBefore time.Time
+}
+
+// Queue staggers the drain requests so the clusters expiring at the same time are not redeployed at once. The
+// pending drains are dispatched in turns among the organizations, with at most a number of drains in flight and
+// a minimum interval between them. As the completion of a drain is not reported back, a drain is in flight for a
+// fixed duration after being sent. A drain that could not be sent waits in the queue with an exponential backoff.
+type Queue struct {
+	sync.Mutex
+	maxConcurrent int
+	interval      time.Duration
+	duration      time.Duration
+	// pending with the drains waiting to be sent per organization, in arrival order.
+	pending map[string][]Drain
+	// turns with the organizations with pending drains, the first one is dispatched next.
+	turns []string
+	// inFlight with the drains sent indexed by cluster key.
+	inFlight map[string]Drain
+	lastSent time.Time
+}
+
+// NewQueue creates an empty queue.
+func NewQueue(maxConcurrent int, interval time.Duration, duration time.Duration) *Queue {
+	return &Queue{
+		maxConcurrent: maxConcurrent,
+		interval:      interval,
+		duration:      duration,
+		pending:       make(map[string][]Drain, 0),
+		turns:         make([]string, 0),
+		inFlight:      make(map[string]Drain, 0),
+	}
+}
+
+// SetLimits replaces the limits of the queue, applied from the next dispatch.
+func (q *Queue) SetLimits(maxConcurrent int, interval time.Duration, duration time.Duration) {
+	q.Lock()
+	defer q.Unlock()
+	q.maxConcurrent = maxConcurrent
+	q.interval = interval
+	q.duration = duration
+}
+
+func key(organizationID string, clusterID string) string {
+	return organizationID + "#" + clusterID
+}
+
+// Enqueue adds the drain of a cluster. It returns false if the cluster is already pending or in flight.
+func (q *Queue) Enqueue(organizationID string, clusterID string, now time.Time) bool {
+	q.Lock()
+	defer q.Unlock()
+	if _, exists := q.inFlight[key(organizationID, clusterID)]; exists {
+		return false
+	}
+	if q.indexOf(organizationID, clusterID) >= 0 {
+		return false
+	}
+	if len(q.pending[organizationID]) == 0 {
+		q.turns = append(q.turns, organizationID)
+	}
+	q.pending[organizationID] = append(q.pending[organizationID], Drain{
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		Enqueued:       now,
+	})
+	return true
+}
+
+func (q *Queue) indexOf(organizationID string, clusterID string) int {
+	for index, drain := range q.pending[organizationID] {
+		if drain.ClusterId == clusterID {
+			return index
+		}
+	}
+	return -1
+}
+
+// Remove cancels the pending drain of a cluster. It returns false if the drain was not pending.
+func (q *Queue) Remove(organizationID string, clusterID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	index := q.indexOf(organizationID, clusterID)
+	if index < 0 {
+		return false
+	}
+	drains := q.pending[organizationID]
+	q.pending[organizationID] = append(drains[:index], drains[index+1:]...)
+	if len(q.pending[organizationID]) == 0 {
+		q.removeTurn(organizationID)
+	}
+	return true
+}
+
+func (q *Queue) removeTurn(organizationID string) {
+	delete(q.pending, organizationID)
+	for index, turn := range q.turns {
+		if turn == organizationID {
+			q.turns = append(q.turns[:index], q.turns[index+1:]...)
+			return
+		}
+	}
+}
+
+// Next returns the drain to be sent, if the limits allow it, and marks it as in flight.
+func (q *Queue) Next(now time.Time) (Drain, bool) {
+	q.Lock()
+	defer q.Unlock()
+	for clusterKey, drain := range q.inFlight {
+		if now.Sub(drain.Sent) >= q.duration {
+			delete(q.inFlight, clusterKey)
+		}
+	}
+	if len(q.turns) == 0 || len(q.inFlight) >= q.maxConcurrent || now.Sub(q.lastSent) < q.interval {
+		return Drain{}, false
+	}
+	// the first organization in turn with a drain not waiting for its backoff
+	for turn, organizationID := range q.turns {
+		drains := q.pending[organizationID]
+		for index, next := range drains {
+			if next.NotBefore.After(now) {
+				continue
+			}
+			q.pending[organizationID] = append(drains[:index], drains[index+1:]...)
+			q.turns = append(q.turns[:turn], q.turns[turn+1:]...)
+			if len(q.pending[organizationID]) == 0 {
+				delete(q.pending, organizationID)
+			} else {
+				q.turns = append(q.turns, organizationID)
+			}
+			return q.send(next, now), true
+		}
+	}
+	return Drain{}, false
+}
+
+func (q *Queue) send(next Drain, now time.Time) Drain {
+	next.Sent = now
+	q.inFlight[key(next.OrganizationId, next.ClusterId)] = next
+	q.lastSent = now
+	return next
+}
+
+// Release frees the slot of a drain that is not sent.
+func (q *Queue) Release(organizationID string, clusterID string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.inFlight, key(organizationID, clusterID))
+}
+
+// Retry frees the slot of a drain that could not be sent and queues it again, at the end of its organization,
+// to be sent once its backoff has elapsed. It returns the time of the next attempt.
+func (q *Queue) Retry(organizationID string, clusterID string, now time.Time) time.Time {
+	q.Lock()
+	defer q.Unlock()
+	clusterKey := key(organizationID, clusterID)
+	failed, exists := q.inFlight[clusterKey]
+	if !exists {
+		failed = Drain{OrganizationId: organizationID, ClusterId: clusterID, Enqueued: now}
+	}
+	delete(q.inFlight, clusterKey)
+	failed.Sent = time.Time{}
+	failed.Failures++
+	failed.NotBefore = now.Add(backoff(failed.Failures))
+	if len(q.pending[organizationID]) == 0 {
+		q.turns = append(q.turns, organizationID)
+	}
+	q.pending[organizationID] = append(q.pending[organizationID], failed)
+	return failed.NotBefore
+}
+
+// backoff returns the wait after a number of failed attempts.
+func backoff(failures int) time.Duration {
+	wait := RetryBackoff
+	for failure := 1; failure < failures; failure++ {
+		wait *= 2
+		if wait > MaxRetryBackoff {
+			return MaxRetryBackoff
+		}
+	}
+	return wait
+}
+
+// Clear removes all the pending and in flight drains.
+func (q *Queue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.pending = make(map[string][]Drain, 0)
+	q.turns = make([]string, 0)
+	q.inFlight = make(map[string]Drain, 0)
+}
+
+// Pending returns the pending drains of an organization in dispatch order within the organization.
+func (q *Queue) Pending(organizationID string) []Drain {
+	q.Lock()
+	defer q.Unlock()
+	return append(make([]Drain, 0, len(q.pending[organizationID])), q.pending[organizationID]...)
+}
+
+// InFlight returns the drains of an organization sent within the drain duration.
+func (q *Queue) InFlight(organizationID string, now time.Time) []Drain {
+	q.Lock()
+	defer q.Unlock()
+	result := make([]Drain, 0)
+	for _, drain := range q.inFlight {
+		if drain.OrganizationId == organizationID && now.Sub(drain.Sent) < q.duration {
+			result = append(result, drain)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Sent.Before(result[j].Sent)
+	})
+	return result
+}
+
+// Len returns the number of pending and in flight drains.
+func (q *Queue) Len() (int, int) {
+	q.Lock()
+	defer q.Unlock()
+	pending := 0
+	for _, drains := range q.pending {
+		pending += len(drains)
+	}
+	return pending, len(q.inFlight)
+}
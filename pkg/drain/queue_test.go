@@ -0,0 +1,177 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package drain
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Drain queue", func() {
+
+	const duration = 5 * time.Minute
+
+	var start time.Time
+
+	// dispatch returns the clusters sent while advancing the time by a step until nothing else is sent.
+	dispatch := func(queue *Queue, now time.Time, step time.Duration, steps int) []string {
+		result := make([]string, 0)
+		for index := 0; index < steps; index++ {
+			if next, sent := queue.Next(now); sent {
+				result = append(result, next.OrganizationId+"/"+next.ClusterId)
+			}
+			now = now.Add(step)
+		}
+		return result
+	}
+
+	ginkgo.BeforeEach(func() {
+		start = time.Unix(1000000, 0)
+	})
+
+	ginkgo.It("should not queue a cluster twice", func() {
+		queue := NewQueue(1, 0, duration)
+		gomega.Expect(queue.Enqueue("org", "a", start)).To(gomega.BeTrue())
+		gomega.Expect(queue.Enqueue("org", "a", start)).To(gomega.BeFalse())
+		_, sent := queue.Next(start)
+		gomega.Expect(sent).To(gomega.BeTrue())
+		gomega.Expect(queue.Enqueue("org", "a", start)).To(gomega.BeFalse())
+		pending, inFlight := queue.Len()
+		gomega.Expect(pending).To(gomega.Equal(0))
+		gomega.Expect(inFlight).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("should take turns among the organizations", func() {
+		queue := NewQueue(10, 0, duration)
+		for _, cluster := range []string{"a1", "a2", "a3"} {
+			queue.Enqueue("a", cluster, start)
+		}
+		queue.Enqueue("b", "b1", start)
+		for _, cluster := range []string{"c1", "c2"} {
+			queue.Enqueue("c", cluster, start)
+		}
+		gomega.Expect(dispatch(queue, start, time.Second, 10)).To(gomega.Equal([]string{
+			"a/a1", "b/b1", "c/c1", "a/a2", "c/c2", "a/a3",
+		}))
+	})
+
+	ginkgo.It("should respect the maximum number of drains in flight", func() {
+		queue := NewQueue(2, 0, duration)
+		for _, cluster := range []string{"a", "b", "c"} {
+			queue.Enqueue("org", cluster, start)
+		}
+		gomega.Expect(dispatch(queue, start, time.Second, 10)).To(gomega.Equal([]string{"org/a", "org/b"}))
+		gomega.Expect(queue.InFlight("org", start.Add(10*time.Second))).To(gomega.HaveLen(2))
+		// a drain is in flight for the drain duration
+		gomega.Expect(dispatch(queue, start.Add(duration), time.Second, 1)).To(gomega.Equal([]string{"org/c"}))
+		gomega.Expect(queue.InFlight("org", start.Add(duration))).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should free the slot of a released drain", func() {
+		queue := NewQueue(1, 0, duration)
+		queue.Enqueue("org", "a", start)
+		queue.Enqueue("org", "b", start)
+		gomega.Expect(dispatch(queue, start, time.Second, 2)).To(gomega.Equal([]string{"org/a"}))
+		queue.Release("org", "a")
+		gomega.Expect(dispatch(queue, start.Add(2*time.Second), time.Second, 1)).To(gomega.Equal([]string{"org/b"}))
+	})
+
+	ginkgo.It("should wait the interval between two drains", func() {
+		queue := NewQueue(10, 30*time.Second, duration)
+		for _, cluster := range []string{"a", "b", "c"} {
+			queue.Enqueue("org", cluster, start)
+		}
+		_, sent := queue.Next(start)
+		gomega.Expect(sent).To(gomega.BeTrue())
+		_, sent = queue.Next(start.Add(29 * time.Second))
+		gomega.Expect(sent).To(gomega.BeFalse())
+		next, sent := queue.Next(start.Add(30 * time.Second))
+		gomega.Expect(sent).To(gomega.BeTrue())
+		gomega.Expect(next.ClusterId).To(gomega.Equal("b"))
+		gomega.Expect(next.Sent).To(gomega.Equal(start.Add(30 * time.Second)))
+	})
+
+	ginkgo.It("should remove a pending drain", func() {
+		queue := NewQueue(10, 0, duration)
+		queue.Enqueue("a", "a1", start)
+		queue.Enqueue("b", "b1", start)
+		gomega.Expect(queue.Remove("a", "a1")).To(gomega.BeTrue())
+		gomega.Expect(queue.Remove("a", "a1")).To(gomega.BeFalse())
+		gomega.Expect(queue.Pending("a")).To(gomega.BeEmpty())
+		gomega.Expect(dispatch(queue, start, time.Second, 3)).To(gomega.Equal([]string{"b/b1"}))
+	})
+
+	ginkgo.Context("retrying a drain", func() {
+
+		ginkgo.It("should double the backoff up to the maximum", func() {
+			gomega.Expect(backoff(1)).To(gomega.Equal(RetryBackoff))
+			gomega.Expect(backoff(2)).To(gomega.Equal(2 * RetryBackoff))
+			gomega.Expect(backoff(3)).To(gomega.Equal(4 * RetryBackoff))
+			gomega.Expect(backoff(100)).To(gomega.Equal(MaxRetryBackoff))
+		})
+
+		ginkgo.It("should queue the drain again after its backoff", func() {
+			queue := NewQueue(1, 0, duration)
+			queue.Enqueue("org", "a", start)
+			_, sent := queue.Next(start)
+			gomega.Expect(sent).To(gomega.BeTrue())
+			gomega.Expect(queue.Retry("org", "a", start)).To(gomega.Equal(start.Add(RetryBackoff)))
+			pending := queue.Pending("org")
+			gomega.Expect(pending).To(gomega.HaveLen(1))
+			gomega.Expect(pending[0].Failures).To(gomega.Equal(1))
+			gomega.Expect(pending[0].Sent.IsZero()).To(gomega.BeTrue())
+			_, sent = queue.Next(start.Add(RetryBackoff - time.Second))
+			gomega.Expect(sent).To(gomega.BeFalse())
+			next, sent := queue.Next(start.Add(RetryBackoff))
+			gomega.Expect(sent).To(gomega.BeTrue())
+			gomega.Expect(next.Enqueued).To(gomega.Equal(start))
+			gomega.Expect(queue.Retry("org", "a", start.Add(RetryBackoff))).To(gomega.Equal(start.Add(3 * RetryBackoff)))
+		})
+
+		ginkgo.It("should send the drains of other organizations while one waits", func() {
+			queue := NewQueue(1, 0, duration)
+			queue.Enqueue("a", "a1", start)
+			queue.Enqueue("b", "b1", start)
+			_, sent := queue.Next(start)
+			gomega.Expect(sent).To(gomega.BeTrue())
+			queue.Retry("a", "a1", start)
+			next, sent := queue.Next(start.Add(time.Second))
+			gomega.Expect(sent).To(gomega.BeTrue())
+			gomega.Expect(next.ClusterId).To(gomega.Equal("b1"))
+		})
+
+		ginkgo.It("should queue a drain that was not in flight", func() {
+			queue := NewQueue(1, 0, duration)
+			queue.Retry("org", "a", start)
+			gomega.Expect(queue.Pending("org")).To(gomega.HaveLen(1))
+			gomega.Expect(queue.Pending("org")[0].Enqueued).To(gomega.Equal(start))
+		})
+	})
+
+	ginkgo.It("should clear the pending and in flight drains", func() {
+		queue := NewQueue(1, 0, duration)
+		queue.Enqueue("org", "a", start)
+		queue.Enqueue("org", "b", start)
+		queue.Next(start)
+		queue.Clear()
+		pending, inFlight := queue.Len()
+		gomega.Expect(pending).To(gomega.Equal(0))
+		gomega.Expect(inFlight).To(gomega.Equal(0))
+		gomega.Expect(queue.Enqueue("org", "a", start)).To(gomega.BeTrue())
+	})
+})
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package election
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// None disables the leader election, the replica is always the leader.
+	None = "none"
+	// Kubernetes uses a Kubernetes Lease object to elect the leader.
+	Kubernetes = "kubernetes"
+)
+
+// Elector interface for the leader election backends. Only the leader replica runs the expiration loop
+// and triggers the offline policies.
+type Elector interface {
+	// Run campaigns for the leadership until the context is cancelled.
+	Run(ctx context.Context)
+	// IsLeader returns true if the replica currently holds the leadership.
+	IsLeader() bool
+	// Leader returns the identity of the replica holding the leadership, empty if it is not known.
+	Leader() string
+}
+
+// ValidBackend checks that the name of a leader election backend is supported.
+func ValidBackend(name string) derrors.Error {
+	switch strings.ToLower(name) {
+	case None, Kubernetes:
+		return nil
+	}
+	return derrors.NewInvalidArgumentError("invalid leader election backend, expecting none or kubernetes").WithParams(name)
+}
+
+// leadership keeps the leadership flag shared between the election loop and the readers.
+type leadership struct {
+	identity string
+	leader   int32
+	// current with the identity of the leader, guarded by currentLock
+	current     string
+	currentLock sync.RWMutex
+}
+
+// IsLeader returns true if the replica currently holds the leadership.
+func (l *leadership) IsLeader() bool {
+	return atomic.LoadInt32(&l.leader) == 1
+}
+
+func (l *leadership) set(leader bool) {
+	value := int32(0)
+	if leader {
+		value = 1
+	}
+	previous := atomic.SwapInt32(&l.leader, value)
+	if previous != value {
+		log.Info().Str("identity", l.identity).Bool("leader", leader).Msg("leadership changed")
+	}
+}
+
+// Leader returns the identity of the replica holding the leadership, empty if it is not known.
+func (l *leadership) Leader() string {
+	l.currentLock.RLock()
+	defer l.currentLock.RUnlock()
+	return l.current
+}
+
+func (l *leadership) setLeader(identity string) {
+	l.currentLock.Lock()
+	defer l.currentLock.Unlock()
+	l.current = identity
+}
+
+// AlwaysLeader is used when the leader election is disabled.
+type AlwaysLeader struct{}
+
+// NewAlwaysLeader creates an elector that always holds the leadership.
+func NewAlwaysLeader() *AlwaysLeader {
+	return &AlwaysLeader{}
+}
+
+// Run returns immediately as there is nothing to campaign for.
+func (a *AlwaysLeader) Run(ctx context.Context) {}
+
+// IsLeader always returns true.
+func (a *AlwaysLeader) IsLeader() bool {
+	return true
+}
+
+// Leader returns an empty identity, as the replica is always the leader.
+func (a *AlwaysLeader) Leader() string {
+	return ""
+}
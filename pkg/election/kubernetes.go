@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package election
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"time"
+)
+
+// KubernetesElector campaigns for a Kubernetes Lease object.
+type KubernetesElector struct {
+	leadership
+	client        kubernetes.Interface
+	namespace     string
+	name          string
+	leaseDuration time.Duration
+}
+
+// NewKubernetesElector creates an elector that uses a Lease object of the cluster the component is running on.
+func NewKubernetesElector(identity string, namespace string, name string, leaseDuration time.Duration) (*KubernetesElector, derrors.Error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot load the in-cluster Kubernetes configuration")
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create the Kubernetes client")
+	}
+	return &KubernetesElector{
+		leadership:    leadership{identity: identity},
+		client:        client,
+		namespace:     namespace,
+		name:          name,
+		leaseDuration: leaseDuration,
+	}, nil
+}
+
+// Run campaigns for the lease until the context is cancelled. When the leadership is lost, the elector
+// campaigns again.
+func (e *KubernetesElector) Run(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      e.name,
+			Namespace: e.namespace,
+		},
+		Client: e.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: e.identity,
+		},
+	}
+	for {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   e.leaseDuration,
+			RenewDeadline:   e.leaseDuration * 2 / 3,
+			RetryPeriod:     e.leaseDuration / 6,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					e.set(true)
+				},
+				OnStoppedLeading: func() {
+					e.set(false)
+				},
+				OnNewLeader: func(identity string) {
+					e.setLeader(identity)
+					log.Debug().Str("leader", identity).Msg("new leader elected")
+				},
+			},
+		})
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
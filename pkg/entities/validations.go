@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	grpc_infrastructure_go "github.com/nalej/grpc-infrastructure-go"
+	grpc_organization_go "github.com/nalej/grpc-organization-go"
+)
+
+const (
+	emptyOrganizationId = "organization_id cannot be empty"
+	emptyClusterId      = "cluster_id cannot be empty"
+	invalidTimestamp    = "timestamp must be a positive value"
+	invalidTimeRange    = "to_timestamp must be greater or equal than from_timestamp"
+	emptyWindowId       = "window_id cannot be empty"
+	invalidWindow       = "end_timestamp must be greater than start_timestamp"
+)
+
+// ValidOrganizationId checks that the organization identifier is set.
+func ValidOrganizationId(organizationID *grpc_organization_go.OrganizationId) derrors.Error {
+	if organizationID == nil || organizationID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	return nil
+}
+
+// ValidClusterId checks that both the organization and the cluster identifiers are set.
+func ValidClusterId(clusterID *grpc_infrastructure_go.ClusterId) derrors.Error {
+	if clusterID == nil || clusterID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if clusterID.ClusterId == "" {
+		return derrors.NewInvalidArgumentError(emptyClusterId)
+	}
+	return nil
+}
+
+// ValidClusterAlive checks that a cluster alive message identifies the cluster and carries a timestamp.
+func ValidClusterAlive(alive *grpc_connectivity_manager_go.ClusterAlive) derrors.Error {
+	if alive == nil || alive.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if alive.ClusterId == "" {
+		return derrors.NewInvalidArgumentError(emptyClusterId)
+	}
+	if alive.Timestamp <= 0 {
+		return derrors.NewInvalidArgumentError(invalidTimestamp)
+	}
+	return nil
+}
+
+// ValidClusterHistoryRequest checks the filters of a history request. A cluster filter requires the organization.
+func ValidClusterHistoryRequest(request *grpc_connectivity_manager_go.ClusterHistoryRequest) derrors.Error {
+	if request == nil {
+		return derrors.NewInvalidArgumentError("request cannot be empty")
+	}
+	if request.ClusterId != "" && request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.FromTimestamp < 0 || request.ToTimestamp < 0 {
+		return derrors.NewInvalidArgumentError(invalidTimestamp)
+	}
+	if request.ToTimestamp != 0 && request.ToTimestamp < request.FromTimestamp {
+		return derrors.NewInvalidArgumentError(invalidTimeRange)
+	}
+	return nil
+}
+
+// ValidConnectivityReportRequest checks that a report request targets an organization over a valid period.
+func ValidConnectivityReportRequest(request *grpc_connectivity_manager_go.ConnectivityReportRequest) derrors.Error {
+	if request == nil || request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.FromTimestamp < 0 || request.ToTimestamp < 0 {
+		return derrors.NewInvalidArgumentError(invalidTimestamp)
+	}
+	if request.ToTimestamp != 0 && request.ToTimestamp <= request.FromTimestamp {
+		return derrors.NewInvalidArgumentError(invalidTimeRange)
+	}
+	return nil
+}
+
+// ValidAddMaintenanceWindowRequest checks that a maintenance window targets an organization and has a valid period.
+func ValidAddMaintenanceWindowRequest(request *grpc_connectivity_manager_go.AddMaintenanceWindowRequest) derrors.Error {
+	if request == nil || request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.StartTimestamp <= 0 || request.EndTimestamp <= 0 {
+		return derrors.NewInvalidArgumentError(invalidTimestamp)
+	}
+	if request.EndTimestamp <= request.StartTimestamp {
+		return derrors.NewInvalidArgumentError(invalidWindow)
+	}
+	return nil
+}
+
+// ValidMaintenanceWindowListRequest checks that the organization is set.
+func ValidMaintenanceWindowListRequest(request *grpc_connectivity_manager_go.MaintenanceWindowListRequest) derrors.Error {
+	if request == nil || request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	return nil
+}
+
+// ValidMaintenanceWindowId checks that both the organization and the window identifiers are set.
+func ValidMaintenanceWindowId(windowID *grpc_connectivity_manager_go.MaintenanceWindowId) derrors.Error {
+	if windowID == nil || windowID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if windowID.WindowId == "" {
+		return derrors.NewInvalidArgumentError(emptyWindowId)
+	}
+	return nil
+}
+
+// ValidReleaseDrainBreakerRequest checks that the release request is set.
+func ValidReleaseDrainBreakerRequest(request *grpc_connectivity_manager_go.ReleaseDrainBreakerRequest) derrors.Error {
+	if request == nil {
+		return derrors.NewInvalidArgumentError("request cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/nalej/derrors"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var historyBucket = []byte("history")
+
+// BoltStore keeps the history in an embedded BoltDB file. Records are keyed by timestamp and insertion
+// sequence so they can be scanned by time range.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the history file.
+func NewBoltStore(path string) (*BoltStore, derrors.Error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot open history store")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, derrors.AsError(err, "cannot create history bucket")
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func recordKey(timestamp int64, sequence uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[0:8], uint64(timestamp))
+	binary.BigEndian.PutUint64(key[8:16], sequence)
+	return key
+}
+
+// Append a record to the history.
+func (s *BoltStore) Append(record Record) derrors.Error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return derrors.AsError(err, "cannot marshal history record")
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(recordKey(record.Timestamp, sequence), value)
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot append history record")
+	}
+	return nil
+}
+
+// Query the history, returning the records sorted by timestamp.
+func (s *BoltStore) Query(filter Filter) ([]Record, derrors.Error) {
+	result := make([]Record, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(historyBucket).Cursor()
+		for key, value := cursor.Seek(recordKey(filter.From, 0)); key != nil; key, value = cursor.Next() {
+			var record Record
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if filter.To != 0 && record.Timestamp > filter.To {
+				break
+			}
+			if filter.Match(record) {
+				result = append(result, record)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot query history")
+	}
+	return result, nil
+}
+
+// Close the history file.
+func (s *BoltStore) Close() derrors.Error {
+	if err := s.db.Close(); err != nil {
+		return derrors.AsError(err, "cannot close history store")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"sort"
+	"sync"
+)
+
+const (
+	// TransitionRecord identifies the records of status changes.
+	TransitionRecord = "transition"
+	// PolicyRecord identifies the records of triggered offline policies.
+	PolicyRecord = "policy"
+)
+
+// Record of the connectivity history of a cluster.
+type Record struct {
+	// Timestamp in seconds when the record was added.
+	Timestamp int64 `json:"timestamp"`
+	// OrganizationId with the organization identifier.
+	OrganizationId string `json:"organization_id"`
+	// ClusterId with the cluster identifier.
+	ClusterId string `json:"cluster_id"`
+	// Kind of record: transition or policy.
+	Kind string `json:"kind"`
+	// From with the status before a transition.
+	From grpc_connectivity_manager_go.ClusterStatus `json:"from"`
+	// To with the status after a transition.
+	To grpc_connectivity_manager_go.ClusterStatus `json:"to"`
+	// Reason with the trigger of a transition or the name of the triggered policy.
+	Reason string `json:"reason"`
+}
+
+// Filter for the history queries. Empty values are not filtered.
+type Filter struct {
+	OrganizationId string
+	ClusterId      string
+	// From with the first timestamp included in the results.
+	From int64
+	// To with the last timestamp included in the results, zero means no limit.
+	To int64
+}
+
+// Match returns true if the record passes the filter.
+func (f Filter) Match(record Record) bool {
+	if f.OrganizationId != "" && f.OrganizationId != record.OrganizationId {
+		return false
+	}
+	if f.ClusterId != "" && f.ClusterId != record.ClusterId {
+		return false
+	}
+	if record.Timestamp < f.From {
+		return false
+	}
+	if f.To != 0 && record.Timestamp > f.To {
+		return false
+	}
+	return true
+}
+
+// Store interface for the append-only connectivity history.
+type Store interface {
+	// Append a record to the history.
+	Append(record Record) derrors.Error
+	// Query the history, returning the records sorted by timestamp.
+	Query(filter Filter) ([]Record, derrors.Error)
+	// Close the store.
+	Close() derrors.Error
+}
+
+// NewStore creates a persistent store on the given path or, if empty, an in-memory store.
+func NewStore(path string) (Store, derrors.Error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewBoltStore(path)
+}
+
+// MemoryStore keeps the history in memory, it is lost when the component stops.
+type MemoryStore struct {
+	sync.Mutex
+	records []Record
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make([]Record, 0)}
+}
+
+// Append a record to the history.
+func (s *MemoryStore) Append(record Record) derrors.Error {
+	s.Lock()
+	defer s.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Query the history, returning the records sorted by timestamp.
+func (s *MemoryStore) Query(filter Filter) ([]Record, derrors.Error) {
+	s.Lock()
+	defer s.Unlock()
+	result := make([]Record, 0)
+	for _, record := range s.records {
+		if filter.Match(record) {
+			result = append(result, record)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp < result[j].Timestamp
+	})
+	return result, nil
+}
+
+// Close does nothing on the in-memory store.
+func (s *MemoryStore) Close() derrors.Error {
+	return nil
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nalej/derrors"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var maintenanceBucket = []byte("maintenance")
+
+// errNotFound is returned by the transactions when a window does not exist.
+var errNotFound = errors.New("maintenance window not found")
+
+// BoltStore keeps the windows in an embedded BoltDB file, keyed by window identifier.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the maintenance file.
+func NewBoltStore(path string) (*BoltStore, derrors.Error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot open maintenance store")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(maintenanceBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, derrors.AsError(err, "cannot create maintenance bucket")
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Add a window.
+func (s *BoltStore) Add(window Window) derrors.Error {
+	value, err := json.Marshal(window)
+	if err != nil {
+		return derrors.AsError(err, "cannot marshal maintenance window")
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(maintenanceBucket).Put([]byte(window.WindowId), value)
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot add maintenance window")
+	}
+	return nil
+}
+
+// Remove a window of an organization.
+func (s *BoltStore) Remove(organizationID string, windowID string) derrors.Error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(maintenanceBucket)
+		value := bucket.Get([]byte(windowID))
+		if value == nil {
+			return errNotFound
+		}
+		var window Window
+		if err := json.Unmarshal(value, &window); err != nil {
+			return err
+		}
+		if window.OrganizationId != organizationID {
+			return errNotFound
+		}
+		return bucket.Delete([]byte(windowID))
+	})
+	if err == errNotFound {
+		return derrors.NewNotFoundError("maintenance window").WithParams(organizationID, windowID)
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot remove maintenance window")
+	}
+	return nil
+}
+
+// Prune removes the windows finished before a given time.
+func (s *BoltStore) Prune(before time.Time) derrors.Error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(maintenanceBucket)
+		expired := make([][]byte, 0)
+		err := bucket.ForEach(func(key []byte, value []byte) error {
+			var window Window
+			if err := json.Unmarshal(value, &window); err != nil {
+				return err
+			}
+			if window.End < before.Unix() {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot prune maintenance windows")
+	}
+	return nil
+}
+
+// List the windows of an organization, restricted to those covering a cluster if clusterID is set.
+func (s *BoltStore) List(organizationID string, clusterID string) ([]Window, derrors.Error) {
+	result := make([]Window, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(maintenanceBucket).ForEach(func(key []byte, value []byte) error {
+			var window Window
+			if err := json.Unmarshal(value, &window); err != nil {
+				return err
+			}
+			if window.OrganizationId == organizationID && (clusterID == "" || window.Covers(organizationID, clusterID)) {
+				result = append(result, window)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot list maintenance windows")
+	}
+	sortByStart(result)
+	return result, nil
+}
+
+// Close the maintenance file.
+func (s *BoltStore) Close() derrors.Error {
+	if err := s.db.Close(); err != nil {
+		return derrors.AsError(err, "cannot close maintenance store")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"encoding/json"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/derrors"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"sync"
+	"time"
+)
+
+// ConfigMapCacheTTL with the time the windows read from the ConfigMap are reused before reading it again.
+const ConfigMapCacheTTL = 10 * time.Second
+
+// ConfigMapStore keeps the windows in a Kubernetes ConfigMap, keyed by window identifier, so they are shared
+// by all the replicas of the component. The windows are cached for ConfigMapCacheTTL, so the changes made
+// through another replica are seen with that delay.
+type ConfigMapStore struct {
+	sync.Mutex
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	clock     clock.Clock
+	cached    []Window
+	cachedAt  time.Time
+}
+
+// NewConfigMapStore creates a store on a ConfigMap of the cluster the component is running on. The ConfigMap
+// is created on the first window added.
+func NewConfigMapStore(namespace string, name string, clock clock.Clock) (*ConfigMapStore, derrors.Error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot load the in-cluster Kubernetes configuration")
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create the Kubernetes client")
+	}
+	return &ConfigMapStore{client: client, namespace: namespace, name: name, clock: clock}, nil
+}
+
+// modify applies a change on the data of the ConfigMap, retrying on conflicts with other replicas.
+func (s *ConfigMapStore) modify(change func(data map[string]string) error) error {
+	s.Lock()
+	defer s.Unlock()
+	s.cached = nil
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+			configMap.Data = make(map[string]string, 0)
+			if err := change(configMap.Data); err != nil {
+				return err
+			}
+			_, err = configMaps.Create(configMap)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string, 0)
+		}
+		if err := change(configMap.Data); err != nil {
+			return err
+		}
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+}
+
+// windows returns all the windows of the ConfigMap, using the cache if it has not expired.
+func (s *ConfigMapStore) windows() ([]Window, derrors.Error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.cached != nil && s.clock.Now().Sub(s.cachedAt) < ConfigMapCacheTTL {
+		return s.cached, nil
+	}
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, derrors.AsError(err, "cannot read maintenance windows")
+	}
+	result := make([]Window, 0)
+	if err == nil {
+		for _, value := range configMap.Data {
+			var window Window
+			if err := json.Unmarshal([]byte(value), &window); err != nil {
+				return nil, derrors.AsError(err, "cannot unmarshal maintenance window")
+			}
+			result = append(result, window)
+		}
+	}
+	s.cached = result
+	s.cachedAt = s.clock.Now()
+	return result, nil
+}
+
+// Add a window.
+func (s *ConfigMapStore) Add(window Window) derrors.Error {
+	value, err := json.Marshal(window)
+	if err != nil {
+		return derrors.AsError(err, "cannot marshal maintenance window")
+	}
+	err = s.modify(func(data map[string]string) error {
+		data[window.WindowId] = string(value)
+		return nil
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot add maintenance window")
+	}
+	return nil
+}
+
+// Prune removes the windows finished before a given time, so the ConfigMap does not grow beyond its size limit.
+func (s *ConfigMapStore) Prune(before time.Time) derrors.Error {
+	err := s.modify(func(data map[string]string) error {
+		for windowID, value := range data {
+			var window Window
+			if err := json.Unmarshal([]byte(value), &window); err != nil {
+				return err
+			}
+			if window.End < before.Unix() {
+				delete(data, windowID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot prune maintenance windows")
+	}
+	return nil
+}
+
+// Remove a window of an organization.
+func (s *ConfigMapStore) Remove(organizationID string, windowID string) derrors.Error {
+	err := s.modify(func(data map[string]string) error {
+		value, exists := data[windowID]
+		if !exists {
+			return errNotFound
+		}
+		var window Window
+		if err := json.Unmarshal([]byte(value), &window); err != nil {
+			return err
+		}
+		if window.OrganizationId != organizationID {
+			return errNotFound
+		}
+		delete(data, windowID)
+		return nil
+	})
+	if err == errNotFound {
+		return derrors.NewNotFoundError("maintenance window").WithParams(organizationID, windowID)
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot remove maintenance window")
+	}
+	return nil
+}
+
+// List the windows of an organization, restricted to those covering a cluster if clusterID is set.
+func (s *ConfigMapStore) List(organizationID string, clusterID string) ([]Window, derrors.Error) {
+	windows, err := s.windows()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Window, 0)
+	for _, window := range windows {
+		if window.OrganizationId == organizationID && (clusterID == "" || window.Covers(organizationID, clusterID)) {
+			result = append(result, window)
+		}
+	}
+	sortByStart(result)
+	return result, nil
+}
+
+// Close does nothing on the ConfigMap store.
+func (s *ConfigMapStore) Close() derrors.Error {
+	return nil
+}
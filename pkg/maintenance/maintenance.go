@@ -0,0 +1,192 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/satori/go.uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Retention with the time the windows are kept after they finish, to count the expiration of the clusters
+// from their end. The older windows are removed on the next change.
+const Retention = 7 * 24 * time.Hour
+
+// Window is a period during which a cluster, or all the clusters of an organization, are expected to stop
+// sending cluster alive checks. Clusters in maintenance are neither transitioned to offline nor drained.
+type Window struct {
+	// WindowId with the window identifier.
+	WindowId string `json:"window_id"`
+	// OrganizationId with the organization identifier.
+	OrganizationId string `json:"organization_id"`
+	// ClusterId with the cluster identifier, empty if the window applies to all the clusters of the organization.
+	ClusterId string `json:"cluster_id"`
+	// Start with the timestamp in seconds when the window begins.
+	Start int64 `json:"start"`
+	// End with the timestamp in seconds when the window finishes.
+	End int64 `json:"end"`
+	// Reason of the maintenance.
+	Reason string `json:"reason"`
+}
+
+// NewWindow creates a window with a new identifier.
+func NewWindow(organizationID string, clusterID string, start int64, end int64, reason string) Window {
+	return Window{
+		WindowId:       uuid.NewV4().String(),
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		Start:          start,
+		End:            end,
+		Reason:         reason,
+	}
+}
+
+// Covers returns true if the window applies to a cluster.
+func (w Window) Covers(organizationID string, clusterID string) bool {
+	return w.OrganizationId == organizationID && (w.ClusterId == "" || w.ClusterId == clusterID)
+}
+
+// ActiveAt returns true if the window is open at a given time.
+func (w Window) ActiveAt(now time.Time) bool {
+	return now.Unix() >= w.Start && now.Unix() < w.End
+}
+
+// Store interface for the maintenance windows.
+type Store interface {
+	// Add a window.
+	Add(window Window) derrors.Error
+	// Remove a window of an organization.
+	Remove(organizationID string, windowID string) derrors.Error
+	// Prune removes the windows finished before a given time.
+	Prune(before time.Time) derrors.Error
+	// List the windows of an organization, restricted to those covering a cluster if clusterID is set, sorted
+	// by start.
+	List(organizationID string, clusterID string) ([]Window, derrors.Error)
+	// Close the store.
+	Close() derrors.Error
+}
+
+// NewStore creates a persistent store on the given path or, if empty, an in-memory store.
+func NewStore(path string) (Store, derrors.Error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewBoltStore(path)
+}
+
+// Active returns the open window covering a cluster that finishes the latest, or nil if the cluster is not in
+// maintenance.
+func Active(store Store, organizationID string, clusterID string, now time.Time) (*Window, derrors.Error) {
+	windows, err := store.List(organizationID, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	var result *Window
+	for index := range windows {
+		if windows[index].ActiveAt(now) && (result == nil || windows[index].End > result.End) {
+			result = &windows[index]
+		}
+	}
+	return result, nil
+}
+
+// LastEnded returns the end of the last window covering a cluster that has already finished, or zero if there
+// is none.
+func LastEnded(store Store, organizationID string, clusterID string, now time.Time) (int64, derrors.Error) {
+	windows, err := store.List(organizationID, clusterID)
+	if err != nil {
+		return 0, err
+	}
+	var result int64
+	for _, window := range windows {
+		if window.Start < window.End && window.End <= now.Unix() && window.End > result {
+			result = window.End
+		}
+	}
+	return result, nil
+}
+
+// sortByStart sorts a list of windows by start time.
+func sortByStart(windows []Window) {
+	sort.SliceStable(windows, func(i, j int) bool {
+		return windows[i].Start < windows[j].Start
+	})
+}
+
+// MemoryStore keeps the windows in memory, they are lost when the component stops.
+type MemoryStore struct {
+	sync.Mutex
+	windows map[string]Window
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[string]Window, 0)}
+}
+
+// Add a window.
+func (s *MemoryStore) Add(window Window) derrors.Error {
+	s.Lock()
+	defer s.Unlock()
+	s.windows[window.WindowId] = window
+	return nil
+}
+
+// Remove a window of an organization.
+func (s *MemoryStore) Remove(organizationID string, windowID string) derrors.Error {
+	s.Lock()
+	defer s.Unlock()
+	window, exists := s.windows[windowID]
+	if !exists || window.OrganizationId != organizationID {
+		return derrors.NewNotFoundError("maintenance window").WithParams(organizationID, windowID)
+	}
+	delete(s.windows, windowID)
+	return nil
+}
+
+// Prune removes the windows finished before a given time.
+func (s *MemoryStore) Prune(before time.Time) derrors.Error {
+	s.Lock()
+	defer s.Unlock()
+	for windowID, window := range s.windows {
+		if window.End < before.Unix() {
+			delete(s.windows, windowID)
+		}
+	}
+	return nil
+}
+
+// List the windows of an organization, restricted to those covering a cluster if clusterID is set.
+func (s *MemoryStore) List(organizationID string, clusterID string) ([]Window, derrors.Error) {
+	s.Lock()
+	defer s.Unlock()
+	result := make([]Window, 0)
+	for _, window := range s.windows {
+		if window.OrganizationId == organizationID && (clusterID == "" || window.Covers(organizationID, clusterID)) {
+			result = append(result, window)
+		}
+	}
+	sortByStart(result)
+	return result, nil
+}
+
+// Close does nothing on the in-memory store.
+func (s *MemoryStore) Close() derrors.Error {
+	return nil
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"path"
+)
+
+const namespace = "connectivity_manager"
+
+var (
+	// ClustersByStatus contains the number of clusters on each status as observed by the last sweep.
+	ClustersByStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clusters",
+		Help:      "Number of clusters per status observed by the last sweep",
+	}, []string{"status"})
+	// HeartbeatsReceived counts the cluster alive checks received per cluster.
+	HeartbeatsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeats_received_total",
+		Help:      "Number of cluster alive checks received",
+	}, []string{"organization_id", "cluster_id"})
+	// HeartbeatsRejected counts the cluster alive checks rejected by the verification of their signature.
+	HeartbeatsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeats_rejected_total",
+		Help:      "Number of cluster alive checks rejected by reason (unsigned, unknown_key, invalid_signature, replayed or expired)",
+	}, []string{"reason"})
+	// HeartbeatsDropped counts the cluster alive checks dropped for being older than the latest one.
+	HeartbeatsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeats_dropped_total",
+		Help:      "Number of cluster alive checks dropped by reason (stale)",
+	}, []string{"reason"})
+	// HeartbeatsCoalesced counts the cluster alive checks whose timestamp was not written to system model immediately.
+	HeartbeatsCoalesced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeats_coalesced_total",
+		Help:      "Number of cluster alive checks whose timestamp was batched instead of written to system model immediately",
+	})
+	// HeartbeatLag contains the difference between the reception time and the timestamp of the last cluster alive check.
+	HeartbeatLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_lag_seconds",
+		Help:      "Seconds between the timestamp of the last cluster alive check and its reception",
+	}, []string{"organization_id", "cluster_id"})
+	// ClockSkew contains the difference between the timestamp of the last cluster alive check and its reception.
+	ClockSkew = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clock_skew_seconds",
+		Help:      "Seconds the clock of the cluster is ahead of the clock of the component, including the transmission delay",
+	}, []string{"organization_id", "cluster_id"})
+	// ClockSkewedClusters contains the number of clusters whose clock skew is beyond the tolerance.
+	ClockSkewedClusters = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clock_skewed_clusters",
+		Help:      "Number of clusters whose clock skew is beyond the tolerance",
+	})
+	// Transitions counts the cluster status changes.
+	Transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transitions_total",
+		Help:      "Number of cluster status transitions",
+	}, []string{"from", "to"})
+	// DrainRequests counts the drain requests sent to the bus by result.
+	DrainRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drain_requests_total",
+		Help:      "Number of drain cluster requests by result (sent or failed)",
+	}, []string{"result"})
+	// PendingDrains contains the number of drains waiting in the drain queue.
+	PendingDrains = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_drains",
+		Help:      "Number of drain cluster requests waiting in the drain queue",
+	})
+	// InFlightDrains contains the number of drains sent within the drain duration.
+	InFlightDrains = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "in_flight_drains",
+		Help:      "Number of drain cluster requests sent within the drain duration",
+	})
+	// DrainBreakerOpen is one while the offline policies are suppressed by the drain breaker.
+	DrainBreakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drain_breaker_open",
+		Help:      "One while the offline policies are suppressed for a suspected partition of the management cluster",
+	})
+	// SuppressedPolicies counts the offline policies suppressed by the drain breaker.
+	SuppressedPolicies = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "suppressed_policies_total",
+		Help:      "Number of offline policies suppressed by the drain breaker",
+	})
+	// SystemModelLatency measures the duration of the requests to system model.
+	SystemModelLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "system_model_request_duration_seconds",
+		Help:      "Duration of the requests to system model",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	// SystemModelErrors counts the failed requests to system model.
+	SystemModelErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "system_model_errors_total",
+		Help:      "Number of failed requests to system model",
+	}, []string{"method"})
+	// SweepDuration measures the duration of each sweep transitioning clusters to offline.
+	SweepDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sweep_duration_seconds",
+		Help:      "Duration of each sweep transitioning clusters to offline",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+	// SweepSkippedOrganizations contains the number of organizations skipped by the last sweep.
+	SweepSkippedOrganizations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sweep_skipped_organizations",
+		Help:      "Number of organizations skipped by the last sweep",
+	})
+	// SweepSkips counts the organizations skipped by the sweeps, the skipped organizations are logged.
+	SweepSkips = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sweep_skips_total",
+		Help:      "Number of organizations skipped by the sweeps, either for an error or for the sweep timeout",
+	})
+	// WebhookDeliveries counts the webhook deliveries by result.
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of webhook deliveries by result (delivered or failed after all the attempts)",
+	}, []string{"result"})
+	// ScheduledExpirations contains the number of clusters with a pending expiration check.
+	ScheduledExpirations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduled_expirations",
+		Help:      "Number of clusters with a pending expiration check",
+	})
+)
+
+const (
+	// DrainSent is the result label of the drain requests successfully sent.
+	DrainSent = "sent"
+	// DrainFailed is the result label of the drain requests that could not be sent.
+	DrainFailed = "failed"
+	// WebhookDelivered is the result label of the webhook deliveries accepted by the endpoint.
+	WebhookDelivered = "delivered"
+	// WebhookFailed is the result label of the webhook deliveries that failed all the attempts.
+	WebhookFailed = "failed"
+)
+
+func init() {
+	prometheus.MustRegister(
+		ClustersByStatus,
+		HeartbeatsReceived,
+		HeartbeatsRejected,
+		HeartbeatsDropped,
+		HeartbeatsCoalesced,
+		HeartbeatLag,
+		ClockSkew,
+		ClockSkewedClusters,
+		Transitions,
+		DrainRequests,
+		PendingDrains,
+		InFlightDrains,
+		DrainBreakerOpen,
+		SuppressedPolicies,
+		SystemModelLatency,
+		SystemModelErrors,
+		SweepDuration,
+		SweepSkippedOrganizations,
+		SweepSkips,
+		ScheduledExpirations,
+		WebhookDeliveries,
+	)
+}
+
+// NewSystemModelInterceptor creates an interceptor that measures the latency and the errors of the unary
+// requests sent to system model.
+func NewSystemModelInterceptor(clock clock.Clock) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := clock.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		name := path.Base(method)
+		SystemModelLatency.WithLabelValues(name).Observe(clock.Now().Sub(start).Seconds())
+		if err != nil {
+			SystemModelErrors.WithLabelValues(name).Inc()
+		}
+		return err
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"io/ioutil"
+	"net/url"
+)
+
+// Events notified to the webhooks.
+const (
+	// ClusterOffline is sent when an online cluster stops sending cluster alive checks for longer than its threshold.
+	ClusterOffline = "cluster_offline"
+	// ClusterCordoned is sent when an offline cluster is cordoned after its grace period.
+	ClusterCordoned = "cluster_cordoned"
+	// ClusterRecovered is sent when an offline cluster comes back and when a recovered cluster is uncordoned.
+	ClusterRecovered = "cluster_recovered"
+)
+
+// Headers of the webhook requests.
+const (
+	// SignatureHeader contains sha256=<hex HMAC-SHA256 of the body with the secret of the endpoint>.
+	SignatureHeader = "X-Connectivity-Manager-Signature"
+	// EventHeader contains the event of the notification.
+	EventHeader = "X-Connectivity-Manager-Event"
+	// DeliveryHeader contains the identifier of the delivery, kept across retries.
+	DeliveryHeader = "X-Connectivity-Manager-Delivery"
+)
+
+// Event returns the event notified for a status change, if any.
+func Event(from grpc_connectivity_manager_go.ClusterStatus, to grpc_connectivity_manager_go.ClusterStatus) (string, bool) {
+	switch {
+	case from == grpc_connectivity_manager_go.ClusterStatus_ONLINE && to == grpc_connectivity_manager_go.ClusterStatus_OFFLINE,
+		from == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON && to == grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON:
+		return ClusterOffline, true
+	case from == grpc_connectivity_manager_go.ClusterStatus_OFFLINE && to == grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON:
+		return ClusterCordoned, true
+	case from == grpc_connectivity_manager_go.ClusterStatus_OFFLINE && to == grpc_connectivity_manager_go.ClusterStatus_ONLINE,
+		from == grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON && to == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON,
+		from == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON && to == grpc_connectivity_manager_go.ClusterStatus_ONLINE:
+		return ClusterRecovered, true
+	}
+	return "", false
+}
+
+// Notification is the JSON payload posted to the webhooks.
+type Notification struct {
+	// Event with the kind of notification.
+	Event string `json:"event"`
+	// OrganizationId with the organization identifier.
+	OrganizationId string `json:"organization_id"`
+	// ClusterId with the cluster identifier.
+	ClusterId string `json:"cluster_id"`
+	// OldStatus with the status before the change.
+	OldStatus string `json:"old_status"`
+	// NewStatus with the status after the change.
+	NewStatus string `json:"new_status"`
+	// Reason with the trigger of the change.
+	Reason string `json:"reason"`
+	// Timestamp in seconds of the change.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Sign returns the value of the signature header for a body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the value of the signature header of a body. It is intended for the receivers of the webhooks.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Endpoint is a webhook that receives the notifications.
+type Endpoint struct {
+	// URL where the notifications are posted.
+	URL string `json:"url"`
+	// Secret used to sign the notifications.
+	Secret string `json:"secret"`
+}
+
+// Validate checks that the URL of the endpoint is absolute.
+func (e Endpoint) Validate() derrors.Error {
+	parsed, err := url.Parse(e.URL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return derrors.NewInvalidArgumentError("invalid webhook URL").WithParams(e.URL)
+	}
+	return nil
+}
+
+// Config contains the webhooks of all the organizations and those of each organization.
+type Config struct {
+	// Endpoints that receive the notifications of all the organizations.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	// Organizations with the endpoints that receive the notifications of an organization, indexed by organization identifier.
+	Organizations map[string][]Endpoint `json:"organizations,omitempty"`
+}
+
+// NewConfig creates a configuration without endpoints.
+func NewConfig() *Config {
+	return &Config{
+		Endpoints:     make([]Endpoint, 0),
+		Organizations: make(map[string][]Endpoint, 0),
+	}
+}
+
+// LoadConfig reads a configuration from a JSON file and validates its endpoints.
+func LoadConfig(path string) (*Config, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read webhook file")
+	}
+	config := NewConfig()
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, derrors.AsError(err, "cannot parse webhook file")
+	}
+	if vErr := config.Validate(); vErr != nil {
+		return nil, vErr
+	}
+	return config, nil
+}
+
+// Validate checks all the endpoints of the configuration.
+func (c *Config) Validate() derrors.Error {
+	for _, endpoint := range c.Endpoints {
+		if err := endpoint.Validate(); err != nil {
+			return err
+		}
+	}
+	for organizationID, endpoints := range c.Organizations {
+		for _, endpoint := range endpoints {
+			if err := endpoint.Validate(); err != nil {
+				return derrors.NewInvalidArgumentError("invalid organization webhook", err).WithParams(organizationID)
+			}
+		}
+	}
+	return nil
+}
+
+// EndpointsOf returns the endpoints that receive the notifications of an organization.
+func (c *Config) EndpointsOf(organizationID string) []Endpoint {
+	result := make([]Endpoint, 0, len(c.Endpoints)+len(c.Organizations[organizationID]))
+	result = append(result, c.Endpoints...)
+	return append(result, c.Organizations[organizationID]...)
+}
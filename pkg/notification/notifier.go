@@ -0,0 +1,278 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/connectivity-manager/pkg/metrics"
+	"github.com/rs/zerolog/log"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// RequestTimeout with the maximum duration of each webhook request.
+	RequestTimeout = 10 * time.Second
+	// MaxBackoff with the maximum wait between two attempts of a delivery.
+	MaxBackoff = 5 * time.Minute
+	// QueueSize with the number of deliveries waiting to be sent, new ones are dropped when it is full.
+	QueueSize = 1000
+	// Workers with the number of deliveries sent in parallel.
+	Workers = 4
+	// RetryResolution with the period at which the deliveries waiting for their next attempt are checked.
+	RetryResolution = 100 * time.Millisecond
+	// MaxLogEntries with the number of deliveries kept in the delivery log.
+	MaxLogEntries = 1000
+)
+
+// Delivery of a notification to an endpoint.
+type Delivery struct {
+	// DeliveryId with the delivery identifier.
+	DeliveryId string
+	// Notification sent.
+	Notification Notification
+	// URL of the endpoint.
+	URL string
+	// Attempts made.
+	Attempts int
+	// StatusCode of the last response, zero if no response was received.
+	StatusCode int
+	// Error of the last attempt, empty if delivered.
+	Error string
+	// Delivered is true if the endpoint answered with a 2xx status code.
+	Delivered bool
+	// Timestamp in seconds of the last attempt.
+	Timestamp int64
+	// secret of the endpoint.
+	secret string
+}
+
+// retry is a failed delivery waiting for its next attempt.
+type retry struct {
+	delivery *Delivery
+	at       time.Time
+}
+
+// Notifier posts the notifications to the webhooks in the background, retrying the failed deliveries with an
+// exponential backoff, and keeps a log of the last deliveries. The workers never wait for a backoff, the
+// failed deliveries are queued again once it has elapsed on the clock, so a dead endpoint does not delay the
+// deliveries to the others.
+type Notifier struct {
+	sync.Mutex
+	config    *Config
+	client    *http.Client
+	attempts  int
+	backoff   time.Duration
+	clock     clock.Clock
+	pending   chan *Delivery
+	log       []Delivery
+	retries   []retry
+	retryLock sync.Mutex
+	// done is closed to stop the workers.
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNotifier creates a notifier and starts its workers. Each delivery is attempted up to attempts times,
+// waiting backoff after the first failure and doubling the wait after each one.
+func NewNotifier(config *Config, attempts int, backoff time.Duration, clock clock.Clock) *Notifier {
+	notifier := &Notifier{
+		config:   config,
+		client:   &http.Client{Timeout: RequestTimeout},
+		attempts: attempts,
+		backoff:  backoff,
+		clock:    clock,
+		pending:  make(chan *Delivery, QueueSize),
+		log:      make([]Delivery, 0),
+		retries:  make([]retry, 0),
+		done:     make(chan struct{}),
+	}
+	for worker := 0; worker < Workers; worker++ {
+		go notifier.work()
+	}
+	go notifier.scheduleRetries()
+	return notifier
+}
+
+// Notify queues the notification for all the endpoints of its organization.
+func (n *Notifier) Notify(notification Notification) {
+	for _, endpoint := range n.config.EndpointsOf(notification.OrganizationId) {
+		delivery := &Delivery{
+			DeliveryId:   uuid.NewV4().String(),
+			Notification: notification,
+			URL:          endpoint.URL,
+			secret:       endpoint.Secret,
+		}
+		select {
+		case n.pending <- delivery:
+		default:
+			delivery.Error = "delivery queue full"
+			delivery.Timestamp = n.clock.Now().Unix()
+			log.Warn().Str("url", delivery.URL).Interface("notification", notification).Msg("webhook delivery queue full, dropping notification")
+			metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookFailed).Inc()
+			n.record(*delivery)
+		}
+	}
+}
+
+// Stop the workers, the pending deliveries are not sent.
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.done)
+	})
+}
+
+// work sends the queued deliveries until the notifier is stopped.
+func (n *Notifier) work() {
+	for {
+		select {
+		case delivery := <-n.pending:
+			if n.attempt(delivery) {
+				n.record(*delivery)
+			}
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// attempt posts a notification once. It returns true if the delivery is finished, either delivered or with
+// its attempts exhausted, otherwise its next attempt is scheduled after the backoff.
+func (n *Notifier) attempt(delivery *Delivery) bool {
+	body, err := json.Marshal(delivery.Notification)
+	if err != nil {
+		delivery.Error = err.Error()
+		return true
+	}
+	now := n.clock.Now()
+	delivery.Attempts++
+	delivery.Timestamp = now.Unix()
+	delivery.StatusCode, err = n.post(delivery, body)
+	if err == nil {
+		delivery.Delivered = true
+		delivery.Error = ""
+		log.Debug().Str("url", delivery.URL).Str("deliveryID", delivery.DeliveryId).Int("attempts", delivery.Attempts).Msg("webhook delivered")
+		metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookDelivered).Inc()
+		return true
+	}
+	delivery.Error = err.Error()
+	log.Warn().Str("url", delivery.URL).Str("deliveryID", delivery.DeliveryId).Int("attempt", delivery.Attempts).Err(err).Msg("webhook delivery failed")
+	if delivery.Attempts >= n.attempts {
+		log.Error().Str("url", delivery.URL).Str("deliveryID", delivery.DeliveryId).Str("err", delivery.Error).Msg("webhook delivery abandoned")
+		metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookFailed).Inc()
+		return true
+	}
+	n.retryLock.Lock()
+	defer n.retryLock.Unlock()
+	n.retries = append(n.retries, retry{delivery: delivery, at: now.Add(n.wait(delivery.Attempts))})
+	return false
+}
+
+// wait returns the backoff after a number of failed attempts.
+func (n *Notifier) wait(attempts int) time.Duration {
+	wait := n.backoff
+	for attempt := 1; attempt < attempts; attempt++ {
+		wait *= 2
+		if wait > MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return wait
+}
+
+// scheduleRetries queues again the deliveries whose backoff has elapsed, checked every RetryResolution until the
+// notifier is stopped. A delivery is kept waiting for the next check if the queue is full.
+func (n *Notifier) scheduleRetries() {
+	ticker := n.clock.NewTicker(RetryResolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			n.requeue(n.clock.Now())
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// requeue queues again the deliveries whose backoff has elapsed.
+func (n *Notifier) requeue(now time.Time) {
+	n.retryLock.Lock()
+	defer n.retryLock.Unlock()
+	waiting := n.retries[:0]
+	for _, next := range n.retries {
+		if next.at.After(now) {
+			waiting = append(waiting, next)
+			continue
+		}
+		select {
+		case n.pending <- next.delivery:
+		default:
+			waiting = append(waiting, next)
+		}
+	}
+	n.retries = waiting
+}
+
+// post sends a single request and returns the status code of the response.
+func (n *Notifier) post(delivery *Delivery, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, Sign(delivery.secret, body))
+	request.Header.Set(EventHeader, delivery.Notification.Event)
+	request.Header.Set(DeliveryHeader, delivery.DeliveryId)
+	response, err := n.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// record appends a delivery to the log, discarding the oldest ones.
+func (n *Notifier) record(delivery Delivery) {
+	n.Lock()
+	defer n.Unlock()
+	n.log = append(n.log, delivery)
+	if len(n.log) > MaxLogEntries {
+		n.log = n.log[len(n.log)-MaxLogEntries:]
+	}
+}
+
+// Deliveries returns the logged deliveries of an organization, the oldest first.
+func (n *Notifier) Deliveries(organizationID string) []Delivery {
+	n.Lock()
+	defer n.Unlock()
+	result := make([]Delivery, 0)
+	for _, delivery := range n.log {
+		if delivery.Notification.OrganizationId == organizationID {
+			result = append(result, delivery)
+		}
+	}
+	return result
+}
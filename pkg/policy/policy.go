@@ -0,0 +1,268 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package policy
+
+import (
+	"encoding/json"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	grpc_infrastructure_go "github.com/nalej/grpc-infrastructure-go"
+	"github.com/rs/zerolog/log"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cluster labels that override the offline settings of a cluster in system model.
+const (
+	OfflinePolicyLabel = "connectivity-manager.nalej.com/offline-policy"
+	ThresholdLabel     = "connectivity-manager.nalej.com/threshold"
+	GracePeriodLabel   = "connectivity-manager.nalej.com/grace-period"
+)
+
+// Override contains the offline settings that replace the global ones. Empty values are not overridden.
+type Override struct {
+	// OfflinePolicy with the name of the offline policy: none or drain.
+	OfflinePolicy string `json:"offlinePolicy,omitempty"`
+	// Threshold with a duration such as 90s or 2m.
+	Threshold string `json:"threshold,omitempty"`
+	// GracePeriod with a duration such as 10m.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+// Validate checks that the values of the override can be parsed.
+func (o Override) Validate() derrors.Error {
+	if o.OfflinePolicy != "" {
+		if _, err := ParseOfflinePolicy(o.OfflinePolicy); err != nil {
+			return err
+		}
+	}
+	if o.Threshold != "" {
+		if _, err := parsePositiveDuration(o.Threshold); err != nil {
+			return err
+		}
+	}
+	if o.GracePeriod != "" {
+		if _, err := parsePositiveDuration(o.GracePeriod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store contains the overrides per organization and per cluster.
+type Store struct {
+	// Organizations indexed by organization identifier.
+	Organizations map[string]Override `json:"organizations,omitempty"`
+	// Clusters indexed by organization identifier and cluster identifier.
+	Clusters map[string]map[string]Override `json:"clusters,omitempty"`
+}
+
+// NewStore creates an empty store.
+func NewStore() *Store {
+	return &Store{
+		Organizations: make(map[string]Override, 0),
+		Clusters:      make(map[string]map[string]Override, 0),
+	}
+}
+
+// LoadStore reads a store from a JSON file and validates its overrides.
+func LoadStore(path string) (*Store, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read policy file")
+	}
+	store := NewStore()
+	if err := json.Unmarshal(content, store); err != nil {
+		return nil, derrors.AsError(err, "cannot parse policy file")
+	}
+	if vErr := store.Validate(); vErr != nil {
+		return nil, vErr
+	}
+	return store, nil
+}
+
+// Validate checks all the overrides of the store.
+func (s *Store) Validate() derrors.Error {
+	for organizationID, override := range s.Organizations {
+		if err := override.Validate(); err != nil {
+			return derrors.NewInvalidArgumentError("invalid organization override", err).WithParams(organizationID)
+		}
+	}
+	for organizationID, clusters := range s.Clusters {
+		for clusterID, override := range clusters {
+			if err := override.Validate(); err != nil {
+				return derrors.NewInvalidArgumentError("invalid cluster override", err).WithParams(organizationID, clusterID)
+			}
+		}
+	}
+	return nil
+}
+
+// MinThreshold returns the shortest threshold of the overrides, false if none overrides it.
+func (s *Store) MinThreshold() (time.Duration, bool) {
+	var result time.Duration
+	found := false
+	check := func(override Override) {
+		if override.Threshold == "" {
+			return
+		}
+		threshold, err := parsePositiveDuration(override.Threshold)
+		if err != nil {
+			return
+		}
+		if !found || threshold < result {
+			result = threshold
+			found = true
+		}
+	}
+	for _, override := range s.Organizations {
+		check(override)
+	}
+	for _, clusters := range s.Clusters {
+		for _, override := range clusters {
+			check(override)
+		}
+	}
+	return result, found
+}
+
+// Effective contains the offline settings that apply to a cluster.
+type Effective struct {
+	OfflinePolicy grpc_connectivity_manager_go.OfflinePolicy
+	Threshold     time.Duration
+	GracePeriod   time.Duration
+}
+
+// Resolver computes the effective offline settings of a cluster. The precedence is, from highest to lowest:
+// cluster labels in system model, cluster overrides of the store, organization overrides of the store and
+// the global settings. The global grace period is the one set by the platform on each cluster, or the default
+// one for the clusters without it. The threshold overrides that are not longer than the floor are ignored.
+type Resolver struct {
+	sync.RWMutex
+	store         *Store
+	offlinePolicy grpc_connectivity_manager_go.OfflinePolicy
+	threshold     time.Duration
+	gracePeriod   time.Duration
+	floor         time.Duration
+}
+
+// NewResolver creates a resolver with the global settings as fallback. The store may be nil.
+func NewResolver(store *Store, offlinePolicy grpc_connectivity_manager_go.OfflinePolicy, threshold time.Duration, gracePeriod time.Duration, floor time.Duration) *Resolver {
+	if store == nil {
+		store = NewStore()
+	}
+	return &Resolver{
+		store:         store,
+		offlinePolicy: offlinePolicy,
+		threshold:     threshold,
+		gracePeriod:   gracePeriod,
+		floor:         floor,
+	}
+}
+
+// Update replaces the store and the global settings. The store may be nil.
+func (r *Resolver) Update(store *Store, offlinePolicy grpc_connectivity_manager_go.OfflinePolicy, threshold time.Duration, gracePeriod time.Duration, floor time.Duration) {
+	if store == nil {
+		store = NewStore()
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.store = store
+	r.offlinePolicy = offlinePolicy
+	r.threshold = threshold
+	r.gracePeriod = gracePeriod
+	r.floor = floor
+}
+
+// Resolve returns the effective offline settings of a cluster.
+func (r *Resolver) Resolve(cluster *grpc_infrastructure_go.Cluster) Effective {
+	r.RLock()
+	defer r.RUnlock()
+	result := Effective{
+		OfflinePolicy: r.offlinePolicy,
+		Threshold:     r.threshold,
+		GracePeriod:   time.Duration(cluster.GracePeriod) * time.Second,
+	}
+	if result.GracePeriod <= 0 {
+		result.GracePeriod = r.gracePeriod
+	}
+	if override, exists := r.store.Organizations[cluster.OrganizationId]; exists {
+		result.apply(override, cluster, r.floor)
+	}
+	if clusters, exists := r.store.Clusters[cluster.OrganizationId]; exists {
+		if override, exists := clusters[cluster.ClusterId]; exists {
+			result.apply(override, cluster, r.floor)
+		}
+	}
+	result.apply(Override{
+		OfflinePolicy: cluster.Labels[OfflinePolicyLabel],
+		Threshold:     cluster.Labels[ThresholdLabel],
+		GracePeriod:   cluster.Labels[GracePeriodLabel],
+	}, cluster, r.floor)
+	return result
+}
+
+// apply replaces the settings that are set on the override. Invalid values, and thresholds not longer than
+// the floor, are ignored.
+func (e *Effective) apply(override Override, cluster *grpc_infrastructure_go.Cluster, floor time.Duration) {
+	if override.OfflinePolicy != "" {
+		if offlinePolicy, err := ParseOfflinePolicy(override.OfflinePolicy); err == nil {
+			e.OfflinePolicy = offlinePolicy
+		} else {
+			log.Warn().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Str("offlinePolicy", override.OfflinePolicy).Msg("ignoring invalid offline policy override")
+		}
+	}
+	if override.Threshold != "" {
+		if threshold, err := parsePositiveDuration(override.Threshold); err == nil && threshold > floor {
+			e.Threshold = threshold
+		} else if err == nil {
+			log.Warn().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Str("threshold", override.Threshold).
+				Dur("floor", floor).Msg("ignoring threshold override not longer than the heartbeat flush interval plus the heartbeat period")
+		} else {
+			log.Warn().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Str("threshold", override.Threshold).Msg("ignoring invalid threshold override")
+		}
+	}
+	if override.GracePeriod != "" {
+		if gracePeriod, err := parsePositiveDuration(override.GracePeriod); err == nil {
+			e.GracePeriod = gracePeriod
+		} else {
+			log.Warn().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Str("gracePeriod", override.GracePeriod).Msg("ignoring invalid grace period override")
+		}
+	}
+}
+
+// ParseOfflinePolicy transforms the name of an offline policy into its value.
+func ParseOfflinePolicy(name string) (grpc_connectivity_manager_go.OfflinePolicy, derrors.Error) {
+	value, exists := grpc_connectivity_manager_go.OfflinePolicy_value[strings.ToUpper(name)]
+	if !exists {
+		return grpc_connectivity_manager_go.OfflinePolicy_NONE, derrors.NewInvalidArgumentError("invalid offline policy").WithParams(name)
+	}
+	return grpc_connectivity_manager_go.OfflinePolicy(value), nil
+}
+
+func parsePositiveDuration(value string) (time.Duration, derrors.Error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, derrors.AsError(err, "invalid duration")
+	}
+	if duration <= 0 {
+		return 0, derrors.NewInvalidArgumentError("duration must be positive").WithParams(value)
+	}
+	return duration, nil
+}
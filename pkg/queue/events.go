@@ -19,68 +19,76 @@ package queue
 import (
 	"context"
 	"fmt"
-	"github.com/hashicorp/golang-lru"
+	"github.com/nalej/connectivity-manager/pkg/bus"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/scheduler"
 	"github.com/nalej/connectivity-manager/pkg/server/connectivity-manager"
-	"github.com/nalej/nalej-bus/pkg/queue/infrastructure/events"
 	"github.com/rs/zerolog/log"
+	"sync"
 	"time"
 )
 
 const (
-	DefaultTimeout   = 2 * time.Minute
-	MaxCachedEntries = 50
+	DefaultTimeout = 2 * time.Minute
 )
 
 type InfrastructureEventsHandler struct {
 	// reference manager for infrastructure
 	manager *connectivity_manager.Manager
 	// events consumer
-	consumer *events.InfrastructureEventsConsumer
-	// cache
-	clusterCache *lru.Cache
+	consumer bus.ClusterAliveConsumer
+	// elector to check if this replica must run the expiration loop
+	elector election.Elector
+	// clock for the timing decisions
+	clock clock.Clock
+	// running with the loops started by Run
+	running *sync.WaitGroup
 }
 
 // Instantiate a new infrastructure events handler to manipulate messages from the infrastructure events queue.
 // params:
 //  cmManager
 //  cons
-func NewInfrastructureEventsHandler(connectivityManagerManager *connectivity_manager.Manager, consumer *events.InfrastructureEventsConsumer) InfrastructureEventsHandler {
-	ieHandler := InfrastructureEventsHandler{manager: connectivityManagerManager, consumer: consumer}
+//  elector
+//  clock
+func NewInfrastructureEventsHandler(connectivityManagerManager *connectivity_manager.Manager, consumer bus.ClusterAliveConsumer, elector election.Elector, clock clock.Clock) InfrastructureEventsHandler {
+	ieHandler := InfrastructureEventsHandler{manager: connectivityManagerManager, consumer: consumer, elector: elector, clock: clock, running: &sync.WaitGroup{}}
 	log.Debug().Msg("new infrastructure events handler created")
 	return ieHandler
 }
 
-type clusterCacheEntry struct {
-	timestamp     time.Time
-	clusterStatus string
+// Run starts the loops of the handler in the background, they finish once the context is cancelled.
+func (i InfrastructureEventsHandler) Run(ctx context.Context, resyncInterval time.Duration, flushInterval time.Duration) {
+	i.start(func() { i.consumeClusterAlive(ctx) })
+	i.start(func() { i.waitRequests(ctx) })
+	i.start(func() { i.checkClusterStatusExpiration(ctx, resyncInterval) })
+	i.start(func() { i.dispatchDrains(ctx) })
+	if flushInterval > 0 {
+		i.start(func() { i.flushHeartbeats(ctx, flushInterval) })
+	}
 }
 
-func newClusterCacheEntry(clusterStatus string) *clusterCacheEntry {
-	return &clusterCacheEntry{
-		timestamp:     time.Now(),
-		clusterStatus: clusterStatus,
-	}
+func (i InfrastructureEventsHandler) start(loop func()) {
+	i.running.Add(1)
+	go func() {
+		defer i.running.Done()
+		loop()
+	}()
 }
 
-func (i InfrastructureEventsHandler) Run(threshold time.Duration) {
-	clusterCache, err := lru.New(MaxCachedEntries)
-	if err != nil {
-		log.Fatal().Err(err).Msg("cannot create cache")
-	}
-	i.clusterCache = clusterCache
-	go i.consumeClusterAlive()
-	go i.waitRequests()
-	go i.checkClusterStatusExpiration(threshold)
+// Wait blocks until the loops started by Run have finished.
+func (i InfrastructureEventsHandler) Wait() {
+	i.running.Wait()
 }
 
-// Endless loop waiting for requests
-func (i InfrastructureEventsHandler) waitRequests() {
+// Loop waiting for requests until the context is cancelled
+func (i InfrastructureEventsHandler) waitRequests(ctx context.Context) {
 	log.Debug().Msg("wait for requests to be received by the infrastructure events queue")
-	for {
+	for ctx.Err() == nil {
 		somethingReceived := false
-		rCtx, rCancel := context.WithTimeout(context.Background(), DefaultTimeout)
-		defer rCancel()
-		currentTime := time.Now()
+		rCtx, rCancel := context.WithTimeout(ctx, DefaultTimeout)
+		currentTime := i.clock.Now()
 		err := i.consumer.Consume(rCtx)
 		somethingReceived = true
 		select {
@@ -94,6 +102,7 @@ func (i InfrastructureEventsHandler) waitRequests() {
 				log.Error().Err(err).Msg("error consuming data from infrastructure events")
 			}
 		}
+		rCancel()
 	}
 }
 
@@ -101,20 +110,84 @@ func (i InfrastructureEventsHandler) getClusterKey(organizationID string, cluste
 	return fmt.Sprintf("%s#%s", organizationID, clusterID)
 }
 
-func (i InfrastructureEventsHandler) consumeClusterAlive() {
+func (i InfrastructureEventsHandler) consumeClusterAlive(ctx context.Context) {
 	log.Debug().Msg("waiting for cluster alive checks...")
 	for {
-		received := <-i.consumer.Config.ChClusterAlive
-		i.manager.ClusterAlive(received)
+		select {
+		case received := <-i.consumer.ClusterAlive():
+			i.manager.ClusterAlive(received)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func (i InfrastructureEventsHandler) checkClusterStatusExpiration(threshold time.Duration) {
+// checkClusterStatusExpiration checks the due expirations every scheduler.Resolution and performs a full resync
+// against system model every resyncInterval, right after becoming the leader and after a configuration reload.
+// The manager is notified of the leadership changes before the next check.
+func (i InfrastructureEventsHandler) checkClusterStatusExpiration(ctx context.Context, resyncInterval time.Duration) {
+	ticker := i.clock.NewTicker(scheduler.Resolution)
+	defer ticker.Stop()
+	var lastResync time.Time
+	leading := false
 	for {
-		ticker := time.NewTicker(threshold)
 		select {
-		case <-ticker.C:
-			i.manager.TransitionClustersToOffline()
+		case <-ticker.C():
+			if !i.elector.IsLeader() {
+				if leading {
+					i.manager.LeadershipLost()
+					leading = false
+					lastResync = time.Time{}
+				}
+				continue
+			}
+			if !leading {
+				i.manager.LeadershipGained()
+				leading = true
+			}
+			now := i.clock.Now()
+			if lastResync.IsZero() || now.Sub(lastResync) >= resyncInterval || i.manager.ResyncRequested() {
+				i.manager.TransitionClustersToOffline()
+				lastResync = now
+				continue
+			}
+			i.manager.TransitionExpiredClusters()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatchDrains sends the queued drains every scheduler.Resolution. Only the leader sends the drains, a replica
+// that loses the leadership leaves the drains it queued to the new leader.
+func (i InfrastructureEventsHandler) dispatchDrains(ctx context.Context) {
+	ticker := i.clock.NewTicker(scheduler.Resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			if i.elector.IsLeader() {
+				i.manager.DispatchDrains()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flushHeartbeats writes the cached last alive timestamps to system model every flushInterval. Only the leader
+// writes the cluster alive checks.
+func (i InfrastructureEventsHandler) flushHeartbeats(ctx context.Context, flushInterval time.Duration) {
+	ticker := i.clock.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			if i.elector.IsLeader() {
+				i.manager.FlushHeartbeats()
+			}
+		case <-ctx.Done():
+			return
 		}
 	}
 }
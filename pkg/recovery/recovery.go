@@ -0,0 +1,172 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recovery
+
+import (
+	"github.com/nalej/derrors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// None never uncordons a recovered cluster automatically.
+	None = "none"
+	// Heartbeats uncordons a recovered cluster after a number of consecutive cluster alive checks.
+	Heartbeats = "heartbeats"
+	// Window uncordons a recovered cluster once it has been sending cluster alive checks for a stability window.
+	Window = "window"
+	// CordonLabel is set on the clusters cordoned by the connectivity manager, with the trigger that cordoned
+	// them. Only those clusters are uncordoned by the recovery policy.
+	CordonLabel = "connectivity-manager.nalej.com/cordoned-by"
+	// SinceLabel is set on the recovering clusters with the Unix time at which their recovery started, so the
+	// recovery survives a restart or a new leader.
+	SinceLabel = "connectivity-manager.nalej.com/recovering-since"
+)
+
+// Policy defines when a cluster that comes back after being cordoned offline is uncordoned.
+type Policy struct {
+	// Name of the policy: none, heartbeats or window.
+	Name string
+	// Heartbeats with the number of consecutive cluster alive checks required by the heartbeats policy.
+	Heartbeats int
+	// Window with the stability period required by the window policy.
+	Window time.Duration
+}
+
+// Validate checks that the policy is supported and its parameters are consistent.
+func (p Policy) Validate() derrors.Error {
+	switch strings.ToLower(p.Name) {
+	case None:
+		return nil
+	case Heartbeats:
+		if p.Heartbeats <= 0 {
+			return derrors.NewInvalidArgumentError("recovery heartbeats must be positive")
+		}
+		return nil
+	case Window:
+		if p.Window <= 0 {
+			return derrors.NewInvalidArgumentError("recovery window must be positive")
+		}
+		return nil
+	}
+	return derrors.NewInvalidArgumentError("invalid recovery policy, expecting none, heartbeats or window").WithParams(p.Name)
+}
+
+type entry struct {
+	since      time.Time
+	heartbeats int
+	// last with the time of the last cluster alive check
+	last time.Time
+}
+
+// Tracker follows the clusters that are recovering from OFFLINE_CORDON and decides when they must be uncordoned.
+// The tracking is kept in memory, the start of each recovery is stored in SinceLabel to restore it.
+type Tracker struct {
+	sync.Mutex
+	policy  Policy
+	entries map[string]*entry
+}
+
+// NewTracker creates a tracker for a given policy.
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{
+		policy:  policy,
+		entries: make(map[string]*entry, 0),
+	}
+}
+
+// SetPolicy replaces the policy, the clusters being tracked are evaluated with the new one.
+func (t *Tracker) SetPolicy(policy Policy) {
+	t.Lock()
+	defer t.Unlock()
+	t.policy = policy
+}
+
+// Start begins tracking a cluster that has just come back online cordoned, counting the cluster alive check
+// that brought it back. It returns false if the policy never uncordons the clusters, and uncordon true if that
+// check already satisfies the policy.
+func (t *Tracker) Start(key string, now time.Time) (tracked bool, uncordon bool) {
+	t.Lock()
+	defer t.Unlock()
+	if strings.ToLower(t.policy.Name) == None {
+		return false, false
+	}
+	e := &entry{since: now, last: now, heartbeats: 1}
+	t.entries[key] = e
+	return true, t.satisfied(e, now)
+}
+
+// Restore tracks again a cluster whose recovery started at a given time, the cluster alive checks received
+// since then are not known so they are counted again.
+func (t *Tracker) Restore(key string, since time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	if strings.ToLower(t.policy.Name) == None {
+		return
+	}
+	if _, exists := t.entries[key]; !exists {
+		t.entries[key] = &entry{since: since}
+	}
+}
+
+// Stop removes a cluster from the tracker.
+func (t *Tracker) Stop(key string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.entries, key)
+}
+
+// Recovering returns true if the cluster is being tracked.
+func (t *Tracker) Recovering(key string) bool {
+	t.Lock()
+	defer t.Unlock()
+	_, exists := t.entries[key]
+	return exists
+}
+
+// Heartbeat records a cluster alive check of a recovering cluster and returns true if the cluster must
+// be uncordoned according to the policy. The checks must be consecutive, so the recovery starts again if
+// the previous check is older than maxGap, in which case restarted is true.
+func (t *Tracker) Heartbeat(key string, now time.Time, maxGap time.Duration) (uncordon bool, restarted bool) {
+	t.Lock()
+	defer t.Unlock()
+	e, exists := t.entries[key]
+	if !exists {
+		return false, false
+	}
+	if !e.last.IsZero() && now.Sub(e.last) > maxGap {
+		e.since = now
+		e.heartbeats = 0
+		restarted = true
+	}
+	e.last = now
+	e.heartbeats++
+	return t.satisfied(e, now), restarted
+}
+
+// satisfied returns true if a recovering cluster must be uncordoned according to the policy. It is called
+// with the lock held.
+func (t *Tracker) satisfied(e *entry, now time.Time) bool {
+	switch strings.ToLower(t.policy.Name) {
+	case Heartbeats:
+		return e.heartbeats >= t.policy.Heartbeats
+	case Window:
+		return now.Sub(e.since) >= t.policy.Window
+	}
+	return false
+}
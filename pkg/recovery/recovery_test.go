@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recovery
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Recovery tracker", func() {
+
+	const key = "org#cluster"
+	const maxGap = time.Minute
+
+	var start time.Time
+
+	ginkgo.BeforeEach(func() {
+		start = time.Unix(1000000, 0)
+	})
+
+	ginkgo.It("should uncordon on exactly the required number of cluster alive checks", func() {
+		tracker := NewTracker(Policy{Name: Heartbeats, Heartbeats: 3})
+		tracked, uncordon := tracker.Start(key, start)
+		gomega.Expect(tracked).To(gomega.BeTrue())
+		gomega.Expect(uncordon).To(gomega.BeFalse())
+		uncordon, _ = tracker.Heartbeat(key, start.Add(10*time.Second), maxGap)
+		gomega.Expect(uncordon).To(gomega.BeFalse())
+		uncordon, _ = tracker.Heartbeat(key, start.Add(20*time.Second), maxGap)
+		gomega.Expect(uncordon).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should uncordon on the check that brings the cluster back if one is required", func() {
+		tracker := NewTracker(Policy{Name: Heartbeats, Heartbeats: 1})
+		tracked, uncordon := tracker.Start(key, start)
+		gomega.Expect(tracked).To(gomega.BeTrue())
+		gomega.Expect(uncordon).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should start again after a gap longer than the maximum", func() {
+		tracker := NewTracker(Policy{Name: Heartbeats, Heartbeats: 2})
+		tracker.Start(key, start)
+		uncordon, restarted := tracker.Heartbeat(key, start.Add(2*maxGap), maxGap)
+		gomega.Expect(restarted).To(gomega.BeTrue())
+		gomega.Expect(uncordon).To(gomega.BeFalse())
+		uncordon, restarted = tracker.Heartbeat(key, start.Add(2*maxGap+10*time.Second), maxGap)
+		gomega.Expect(restarted).To(gomega.BeFalse())
+		gomega.Expect(uncordon).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should uncordon once the stability window has passed", func() {
+		tracker := NewTracker(Policy{Name: Window, Window: 30 * time.Second})
+		_, uncordon := tracker.Start(key, start)
+		gomega.Expect(uncordon).To(gomega.BeFalse())
+		uncordon, _ = tracker.Heartbeat(key, start.Add(20*time.Second), maxGap)
+		gomega.Expect(uncordon).To(gomega.BeFalse())
+		uncordon, _ = tracker.Heartbeat(key, start.Add(30*time.Second), maxGap)
+		gomega.Expect(uncordon).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should not track the clusters with the none policy", func() {
+		tracker := NewTracker(Policy{Name: None})
+		tracked, _ := tracker.Start(key, start)
+		gomega.Expect(tracked).To(gomega.BeFalse())
+		gomega.Expect(tracker.Recovering(key)).To(gomega.BeFalse())
+	})
+
+})
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/history"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"io"
+	"sort"
+)
+
+// ClusterReport with the availability of a cluster over a period. Durations are expressed in seconds.
+type ClusterReport struct {
+	OrganizationId string `json:"organization_id"`
+	ClusterId      string `json:"cluster_id"`
+	// Uptime percentage over the time the status of the cluster was known.
+	Uptime float64 `json:"uptime"`
+	// Outages with the number of periods the cluster was offline.
+	Outages int `json:"outages"`
+	// Downtime with the total time the cluster was offline.
+	Downtime int64 `json:"downtime"`
+	// MTTR with the mean time to recovery of the outages that ended within the period.
+	MTTR int64 `json:"mttr"`
+	// LongestOutage with the duration of the longest outage, including the ongoing one.
+	LongestOutage int64 `json:"longest_outage"`
+	// measured with the time the status of the cluster was known.
+	measured int64
+}
+
+// Report with the availability of the clusters of an organization over a period.
+type Report struct {
+	OrganizationId string `json:"organization_id"`
+	From           int64  `json:"from"`
+	To             int64  `json:"to"`
+	// Uptime percentage of the organization weighted by the time each cluster status was known.
+	Uptime   float64         `json:"uptime"`
+	Clusters []ClusterReport `json:"clusters"`
+}
+
+// Online returns true if the status counts as available.
+func Online(status grpc_connectivity_manager_go.ClusterStatus) bool {
+	return status == grpc_connectivity_manager_go.ClusterStatus_ONLINE || status == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON
+}
+
+// Offline returns true if the status counts as an outage.
+func Offline(status grpc_connectivity_manager_go.ClusterStatus) bool {
+	return status == grpc_connectivity_manager_go.ClusterStatus_OFFLINE || status == grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON
+}
+
+// ComputeCluster calculates the report of a cluster from its transition records, sorted by timestamp, and its
+// current status. The status at the beginning of the period is the one left by the last transition before it,
+// the origin status of the first transition or, without transitions, the current status. Time spent in
+// UNKNOWN status is not measured.
+func ComputeCluster(organizationID string, clusterID string, records []history.Record, current grpc_connectivity_manager_go.ClusterStatus, from int64, to int64) ClusterReport {
+	result := ClusterReport{OrganizationId: organizationID, ClusterId: clusterID}
+	transitions := make([]history.Record, 0, len(records))
+	for _, record := range records {
+		if record.Kind == history.TransitionRecord && record.Timestamp <= to {
+			transitions = append(transitions, record)
+		}
+	}
+
+	status := current
+	if len(transitions) > 0 {
+		status = transitions[0].From
+	}
+	index := 0
+	for ; index < len(transitions) && transitions[index].Timestamp <= from; index++ {
+		status = transitions[index].To
+	}
+
+	var online, recovered, recoveries int64
+	outageStart := int64(-1)
+	if Offline(status) {
+		outageStart = from
+		result.Outages++
+	}
+	cursor := from
+	account := func(until int64) {
+		elapsed := until - cursor
+		if Online(status) {
+			online += elapsed
+			result.measured += elapsed
+		} else if Offline(status) {
+			result.Downtime += elapsed
+			result.measured += elapsed
+		}
+		cursor = until
+	}
+	for ; index < len(transitions); index++ {
+		transition := transitions[index]
+		account(transition.Timestamp)
+		if !Offline(status) && Offline(transition.To) {
+			outageStart = transition.Timestamp
+			result.Outages++
+		} else if Offline(status) && !Offline(transition.To) {
+			duration := transition.Timestamp - outageStart
+			recovered += duration
+			recoveries++
+			if duration > result.LongestOutage {
+				result.LongestOutage = duration
+			}
+			outageStart = -1
+		}
+		status = transition.To
+	}
+	account(to)
+	if outageStart >= 0 && to-outageStart > result.LongestOutage {
+		result.LongestOutage = to - outageStart
+	}
+	if recoveries > 0 {
+		result.MTTR = recovered / recoveries
+	}
+	if result.measured > 0 {
+		result.Uptime = 100 * float64(online) / float64(result.measured)
+	}
+	return result
+}
+
+// Compute calculates the report of an organization. The records of each cluster must be sorted by timestamp
+// and the current status of every cluster to include must be set.
+func Compute(organizationID string, records []history.Record, current map[string]grpc_connectivity_manager_go.ClusterStatus, from int64, to int64) Report {
+	byCluster := make(map[string][]history.Record, 0)
+	for _, record := range records {
+		byCluster[record.ClusterId] = append(byCluster[record.ClusterId], record)
+	}
+	result := Report{OrganizationId: organizationID, From: from, To: to, Clusters: make([]ClusterReport, 0, len(current))}
+	var online, measured float64
+	for clusterID, status := range current {
+		clusterReport := ComputeCluster(organizationID, clusterID, byCluster[clusterID], status, from, to)
+		result.Clusters = append(result.Clusters, clusterReport)
+		online += clusterReport.Uptime * float64(clusterReport.measured)
+		measured += float64(clusterReport.measured)
+	}
+	sort.Slice(result.Clusters, func(i, j int) bool {
+		return result.Clusters[i].ClusterId < result.Clusters[j].ClusterId
+	})
+	if measured > 0 {
+		result.Uptime = online / measured
+	}
+	return result
+}
+
+// ToGRPC transforms a report into its gRPC representation.
+func (r Report) ToGRPC() *grpc_connectivity_manager_go.ConnectivityReport {
+	clusters := make([]*grpc_connectivity_manager_go.ClusterConnectivityReport, 0, len(r.Clusters))
+	for _, c := range r.Clusters {
+		clusters = append(clusters, &grpc_connectivity_manager_go.ClusterConnectivityReport{
+			OrganizationId: c.OrganizationId,
+			ClusterId:      c.ClusterId,
+			Uptime:         c.Uptime,
+			Outages:        int32(c.Outages),
+			Downtime:       c.Downtime,
+			Mttr:           c.MTTR,
+			LongestOutage:  c.LongestOutage,
+		})
+	}
+	return &grpc_connectivity_manager_go.ConnectivityReport{
+		OrganizationId: r.OrganizationId,
+		FromTimestamp:  r.From,
+		ToTimestamp:    r.To,
+		Uptime:         r.Uptime,
+		Clusters:       clusters,
+	}
+}
+
+// FromGRPC transforms the gRPC representation of a report.
+func FromGRPC(report *grpc_connectivity_manager_go.ConnectivityReport) Report {
+	clusters := make([]ClusterReport, 0, len(report.Clusters))
+	for _, c := range report.Clusters {
+		clusters = append(clusters, ClusterReport{
+			OrganizationId: c.OrganizationId,
+			ClusterId:      c.ClusterId,
+			Uptime:         c.Uptime,
+			Outages:        int(c.Outages),
+			Downtime:       c.Downtime,
+			MTTR:           c.Mttr,
+			LongestOutage:  c.LongestOutage,
+		})
+	}
+	return Report{
+		OrganizationId: report.OrganizationId,
+		From:           report.FromTimestamp,
+		To:             report.ToTimestamp,
+		Uptime:         report.Uptime,
+		Clusters:       clusters,
+	}
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) derrors.Error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return derrors.AsError(err, "cannot write report")
+	}
+	return nil
+}
+
+// WriteCSV writes a row per cluster with a header.
+func (r Report) WriteCSV(w io.Writer) derrors.Error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{{"organization_id", "cluster_id", "from", "to", "uptime", "outages", "downtime", "mttr", "longest_outage"}}
+	for _, c := range r.Clusters {
+		rows = append(rows, []string{
+			c.OrganizationId,
+			c.ClusterId,
+			fmt.Sprintf("%d", r.From),
+			fmt.Sprintf("%d", r.To),
+			fmt.Sprintf("%.4f", c.Uptime),
+			fmt.Sprintf("%d", c.Outages),
+			fmt.Sprintf("%d", c.Downtime),
+			fmt.Sprintf("%d", c.MTTR),
+			fmt.Sprintf("%d", c.LongestOutage),
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return derrors.AsError(err, "cannot write report")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/nalej/connectivity-manager/pkg/history"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = ginkgo.Describe("Connectivity report", func() {
+
+	const organizationID = "org"
+
+	transition := func(clusterID string, timestamp int64, from grpc_connectivity_manager_go.ClusterStatus, to grpc_connectivity_manager_go.ClusterStatus) history.Record {
+		return history.Record{
+			Timestamp:      timestamp,
+			OrganizationId: organizationID,
+			ClusterId:      clusterID,
+			Kind:           history.TransitionRecord,
+			From:           from,
+			To:             to,
+		}
+	}
+
+	// outages with an outage recovered within the period and an ongoing one at its end.
+	outages := []history.Record{
+		transition("a", 100, grpc_connectivity_manager_go.ClusterStatus_ONLINE, grpc_connectivity_manager_go.ClusterStatus_OFFLINE),
+		transition("a", 200, grpc_connectivity_manager_go.ClusterStatus_OFFLINE, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON),
+		{Timestamp: 200, OrganizationId: organizationID, ClusterId: "a", Kind: history.PolicyRecord, Reason: "drain"},
+		transition("a", 400, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON),
+		transition("a", 500, grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, grpc_connectivity_manager_go.ClusterStatus_ONLINE),
+		transition("a", 900, grpc_connectivity_manager_go.ClusterStatus_ONLINE, grpc_connectivity_manager_go.ClusterStatus_OFFLINE),
+	}
+
+	ginkgo.Context("of a cluster", func() {
+
+		ginkgo.It("should use the current status without transitions", func() {
+			online := ComputeCluster(organizationID, "a", nil, grpc_connectivity_manager_go.ClusterStatus_ONLINE, 0, 1000)
+			gomega.Expect(online.Uptime).To(gomega.Equal(100.0))
+			gomega.Expect(online.Outages).To(gomega.Equal(0))
+			gomega.Expect(online.Downtime).To(gomega.Equal(int64(0)))
+
+			offline := ComputeCluster(organizationID, "a", nil, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, 0, 1000)
+			gomega.Expect(offline.Uptime).To(gomega.Equal(0.0))
+			gomega.Expect(offline.Outages).To(gomega.Equal(1))
+			gomega.Expect(offline.Downtime).To(gomega.Equal(int64(1000)))
+			gomega.Expect(offline.LongestOutage).To(gomega.Equal(int64(1000)))
+			gomega.Expect(offline.MTTR).To(gomega.Equal(int64(0)))
+		})
+
+		ginkgo.It("should aggregate the outages", func() {
+			result := ComputeCluster(organizationID, "a", outages, grpc_connectivity_manager_go.ClusterStatus_OFFLINE, 0, 1000)
+			gomega.Expect(result.Uptime).To(gomega.Equal(60.0))
+			gomega.Expect(result.Outages).To(gomega.Equal(2))
+			gomega.Expect(result.Downtime).To(gomega.Equal(int64(400)))
+			gomega.Expect(result.MTTR).To(gomega.Equal(int64(300)))
+			gomega.Expect(result.LongestOutage).To(gomega.Equal(int64(300)))
+		})
+
+		ginkgo.It("should start with the status left by the transitions before the period", func() {
+			result := ComputeCluster(organizationID, "a", outages, grpc_connectivity_manager_go.ClusterStatus_OFFLINE, 300, 600)
+			gomega.Expect(result.Outages).To(gomega.Equal(1))
+			gomega.Expect(result.Downtime).To(gomega.Equal(int64(100)))
+			gomega.Expect(result.MTTR).To(gomega.Equal(int64(100)))
+			gomega.Expect(result.Uptime).To(gomega.BeNumerically("~", 100*200.0/300.0, 1e-9))
+		})
+
+		ginkgo.It("should ignore the transitions after the period", func() {
+			result := ComputeCluster(organizationID, "a", outages, grpc_connectivity_manager_go.ClusterStatus_OFFLINE, 0, 150)
+			gomega.Expect(result.Uptime).To(gomega.BeNumerically("~", 100*100.0/150.0, 1e-9))
+			gomega.Expect(result.Outages).To(gomega.Equal(1))
+			gomega.Expect(result.Downtime).To(gomega.Equal(int64(50)))
+			gomega.Expect(result.LongestOutage).To(gomega.Equal(int64(50)))
+			gomega.Expect(result.MTTR).To(gomega.Equal(int64(0)))
+		})
+
+		ginkgo.It("should not measure the time in UNKNOWN status", func() {
+			records := []history.Record{
+				transition("a", 500, grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, grpc_connectivity_manager_go.ClusterStatus_ONLINE),
+				transition("a", 750, grpc_connectivity_manager_go.ClusterStatus_ONLINE, grpc_connectivity_manager_go.ClusterStatus_OFFLINE),
+			}
+			result := ComputeCluster(organizationID, "a", records, grpc_connectivity_manager_go.ClusterStatus_OFFLINE, 0, 1000)
+			gomega.Expect(result.Uptime).To(gomega.Equal(50.0))
+			gomega.Expect(result.Downtime).To(gomega.Equal(int64(250)))
+			gomega.Expect(result.LongestOutage).To(gomega.Equal(int64(250)))
+		})
+	})
+
+	ginkgo.Context("of an organization", func() {
+
+		current := map[string]grpc_connectivity_manager_go.ClusterStatus{
+			"c": grpc_connectivity_manager_go.ClusterStatus_UNKNOWN,
+			"b": grpc_connectivity_manager_go.ClusterStatus_ONLINE,
+			"a": grpc_connectivity_manager_go.ClusterStatus_OFFLINE,
+		}
+
+		ginkgo.It("should weight the uptime by the time each cluster status was known", func() {
+			result := Compute(organizationID, outages, current, 0, 1000)
+			gomega.Expect(result.OrganizationId).To(gomega.Equal(organizationID))
+			gomega.Expect(result.From).To(gomega.Equal(int64(0)))
+			gomega.Expect(result.To).To(gomega.Equal(int64(1000)))
+			gomega.Expect(result.Uptime).To(gomega.Equal(80.0))
+			gomega.Expect(result.Clusters).To(gomega.HaveLen(3))
+			gomega.Expect(result.Clusters[0].ClusterId).To(gomega.Equal("a"))
+			gomega.Expect(result.Clusters[0].Uptime).To(gomega.Equal(60.0))
+			gomega.Expect(result.Clusters[1].ClusterId).To(gomega.Equal("b"))
+			gomega.Expect(result.Clusters[1].Uptime).To(gomega.Equal(100.0))
+			gomega.Expect(result.Clusters[2].ClusterId).To(gomega.Equal("c"))
+			gomega.Expect(result.Clusters[2].Uptime).To(gomega.Equal(0.0))
+		})
+
+		ginkgo.It("should only include the clusters with a current status", func() {
+			result := Compute(organizationID, outages, map[string]grpc_connectivity_manager_go.ClusterStatus{
+				"b": grpc_connectivity_manager_go.ClusterStatus_ONLINE,
+			}, 0, 1000)
+			gomega.Expect(result.Clusters).To(gomega.HaveLen(1))
+			gomega.Expect(result.Uptime).To(gomega.Equal(100.0))
+		})
+
+		ginkgo.It("should keep the report through its gRPC representation", func() {
+			result := Compute(organizationID, outages, current, 0, 1000)
+			converted := FromGRPC(result.ToGRPC())
+			gomega.Expect(converted.Uptime).To(gomega.Equal(result.Uptime))
+			gomega.Expect(converted.Clusters).To(gomega.HaveLen(len(result.Clusters)))
+			for index, cluster := range result.Clusters {
+				cluster.measured = 0
+				gomega.Expect(converted.Clusters[index]).To(gomega.Equal(cluster))
+			}
+		})
+
+		ginkgo.It("should write a row per cluster", func() {
+			result := Compute(organizationID, outages, current, 0, 1000)
+			var csv bytes.Buffer
+			gomega.Expect(result.WriteCSV(&csv)).To(gomega.Succeed())
+			rows := strings.Split(strings.TrimSpace(csv.String()), "\n")
+			gomega.Expect(rows).To(gomega.HaveLen(4))
+			gomega.Expect(rows[0]).To(gomega.HavePrefix("organization_id,cluster_id"))
+			gomega.Expect(rows[1]).To(gomega.Equal("org,a,0,1000,60.0000,2,400,300,300"))
+
+			var encoded bytes.Buffer
+			gomega.Expect(result.WriteJSON(&encoded)).To(gomega.Succeed())
+			decoded := Report{}
+			gomega.Expect(json.Unmarshal(encoded.Bytes(), &decoded)).To(gomega.Succeed())
+			gomega.Expect(decoded.Uptime).To(gomega.Equal(result.Uptime))
+			gomega.Expect(decoded.Clusters).To(gomega.HaveLen(3))
+		})
+	})
+})
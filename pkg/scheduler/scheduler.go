@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Resolution with the period at which the due deadlines are checked.
+const Resolution = time.Second
+
+// Deadline is the time at which the status of a cluster must be checked.
+type Deadline struct {
+	// Key that identifies the cluster.
+	Key string
+	// OrganizationId of the cluster.
+	OrganizationId string
+	// ClusterId of the cluster.
+	ClusterId string
+	// At with the time of the check.
+	At time.Time
+	// index in the heap.
+	index int
+}
+
+// deadlineHeap is a min-heap of deadlines ordered by time.
+type deadlineHeap []*Deadline
+
+func (h deadlineHeap) Len() int {
+	return len(h)
+}
+
+func (h deadlineHeap) Less(i, j int) bool {
+	return h[i].At.Before(h[j].At)
+}
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	deadline := x.(*Deadline)
+	deadline.index = len(*h)
+	*h = append(*h, deadline)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	deadline := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return deadline
+}
+
+// Scheduler keeps a single deadline per cluster and returns the ones that are due.
+type Scheduler struct {
+	sync.Mutex
+	deadlines deadlineHeap
+	byKey     map[string]*Deadline
+}
+
+// NewScheduler creates an empty scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		deadlines: make(deadlineHeap, 0),
+		byKey:     make(map[string]*Deadline, 0),
+	}
+}
+
+// Schedule sets the deadline of a cluster, replacing the previous one.
+func (s *Scheduler) Schedule(key string, organizationID string, clusterID string, at time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	if deadline, exists := s.byKey[key]; exists {
+		deadline.At = at
+		heap.Fix(&s.deadlines, deadline.index)
+		return
+	}
+	deadline := &Deadline{Key: key, OrganizationId: organizationID, ClusterId: clusterID, At: at}
+	heap.Push(&s.deadlines, deadline)
+	s.byKey[key] = deadline
+}
+
+// Cancel removes the deadline of a cluster.
+func (s *Scheduler) Cancel(key string) {
+	s.Lock()
+	defer s.Unlock()
+	if deadline, exists := s.byKey[key]; exists {
+		heap.Remove(&s.deadlines, deadline.index)
+		delete(s.byKey, key)
+	}
+}
+
+// Due removes and returns the deadlines that are not after now, the earliest first.
+func (s *Scheduler) Due(now time.Time) []Deadline {
+	s.Lock()
+	defer s.Unlock()
+	result := make([]Deadline, 0)
+	for len(s.deadlines) > 0 && !s.deadlines[0].At.After(now) {
+		deadline := heap.Pop(&s.deadlines).(*Deadline)
+		delete(s.byKey, deadline.Key)
+		result = append(result, *deadline)
+	}
+	return result
+}
+
+// Retain removes the deadlines of the clusters whose key is not in the given set.
+func (s *Scheduler) Retain(keys map[string]bool) {
+	s.Lock()
+	defer s.Unlock()
+	for key, deadline := range s.byKey {
+		if !keys[key] {
+			heap.Remove(&s.deadlines, deadline.index)
+			delete(s.byKey, key)
+		}
+	}
+}
+
+// Len returns the number of scheduled deadlines.
+func (s *Scheduler) Len() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.deadlines)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Scheduler", func() {
+
+	var start time.Time
+	var scheduler *Scheduler
+
+	keys := func(deadlines []Deadline) []string {
+		result := make([]string, 0, len(deadlines))
+		for _, deadline := range deadlines {
+			result = append(result, deadline.Key)
+		}
+		return result
+	}
+
+	ginkgo.BeforeEach(func() {
+		start = time.Unix(1000000, 0)
+		scheduler = NewScheduler()
+	})
+
+	ginkgo.It("should return the due deadlines, the earliest first", func() {
+		scheduler.Schedule("c", "org", "c", start.Add(30*time.Second))
+		scheduler.Schedule("a", "org", "a", start.Add(10*time.Second))
+		scheduler.Schedule("d", "org", "d", start.Add(40*time.Second))
+		scheduler.Schedule("b", "org", "b", start.Add(20*time.Second))
+		gomega.Expect(scheduler.Due(start.Add(5 * time.Second))).To(gomega.BeEmpty())
+		due := scheduler.Due(start.Add(30 * time.Second))
+		gomega.Expect(keys(due)).To(gomega.Equal([]string{"a", "b", "c"}))
+		gomega.Expect(due[0].OrganizationId).To(gomega.Equal("org"))
+		gomega.Expect(due[0].ClusterId).To(gomega.Equal("a"))
+		gomega.Expect(due[0].At).To(gomega.Equal(start.Add(10 * time.Second)))
+		gomega.Expect(scheduler.Len()).To(gomega.Equal(1))
+		gomega.Expect(scheduler.Due(start.Add(30 * time.Second))).To(gomega.BeEmpty())
+		gomega.Expect(keys(scheduler.Due(start.Add(time.Minute)))).To(gomega.Equal([]string{"d"}))
+		gomega.Expect(scheduler.Len()).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should keep a single deadline per cluster when rescheduled", func() {
+		scheduler.Schedule("a", "org", "a", start.Add(10*time.Second))
+		scheduler.Schedule("b", "org", "b", start.Add(20*time.Second))
+		scheduler.Schedule("a", "org", "a", start.Add(30*time.Second))
+		gomega.Expect(scheduler.Len()).To(gomega.Equal(2))
+		gomega.Expect(keys(scheduler.Due(start.Add(20 * time.Second)))).To(gomega.Equal([]string{"b"}))
+		// moving a deadline earlier reorders the heap too
+		scheduler.Schedule("c", "org", "c", start.Add(50*time.Second))
+		scheduler.Schedule("c", "org", "c", start.Add(25*time.Second))
+		gomega.Expect(keys(scheduler.Due(start.Add(time.Minute)))).To(gomega.Equal([]string{"c", "a"}))
+	})
+
+	ginkgo.It("should keep the order after rescheduling many deadlines", func() {
+		for index := 0; index < 50; index++ {
+			key := string(rune('A' + index))
+			scheduler.Schedule(key, "org", key, start.Add(time.Duration(index)*time.Second))
+		}
+		// reverse the order
+		for index := 0; index < 50; index++ {
+			key := string(rune('A' + index))
+			scheduler.Schedule(key, "org", key, start.Add(time.Duration(100-index)*time.Second))
+		}
+		due := scheduler.Due(start.Add(time.Hour))
+		gomega.Expect(due).To(gomega.HaveLen(50))
+		for index := 1; index < len(due); index++ {
+			gomega.Expect(due[index-1].At.After(due[index].At)).To(gomega.BeFalse())
+		}
+		gomega.Expect(due[0].Key).To(gomega.Equal(string(rune('A' + 49))))
+	})
+
+	ginkgo.It("should cancel a deadline", func() {
+		scheduler.Schedule("a", "org", "a", start.Add(10*time.Second))
+		scheduler.Schedule("b", "org", "b", start.Add(20*time.Second))
+		scheduler.Cancel("a")
+		scheduler.Cancel("missing")
+		gomega.Expect(keys(scheduler.Due(start.Add(time.Minute)))).To(gomega.Equal([]string{"b"}))
+	})
+
+	ginkgo.It("should retain only the given clusters", func() {
+		scheduler.Schedule("a", "org", "a", start.Add(10*time.Second))
+		scheduler.Schedule("b", "org", "b", start.Add(20*time.Second))
+		scheduler.Schedule("c", "org", "c", start.Add(30*time.Second))
+		scheduler.Retain(map[string]bool{"a": true, "c": true})
+		gomega.Expect(scheduler.Len()).To(gomega.Equal(2))
+		gomega.Expect(keys(scheduler.Due(start.Add(time.Minute)))).To(gomega.Equal([]string{"a", "c"}))
+	})
+})
@@ -17,43 +17,296 @@
 package config
 
 import (
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/detector"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/policy"
+	"github.com/nalej/connectivity-manager/pkg/recovery"
 	"github.com/nalej/connectivity-manager/version"
 	"github.com/nalej/derrors"
 	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
 	"github.com/rs/zerolog/log"
+	"net"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	// incoming port
 	Port uint32
+	// MetricsPort with the HTTP port serving the Prometheus metrics
+	MetricsPort uint32
 	// Debugging flag
 	Debug bool
+	// DryRun computes the transitions and the offline policies without writing them to system model nor sending them to the bus
+	DryRun bool
 	// SystemModelAddress with the host:port to connect to System Model
 	SystemModelAddress string
 	// URL for the message queue
 	QueueAddress string
 	// Threshold
 	Threshold time.Duration
+	// PlatformGracePeriod with the grace period set by the platform on the clusters, applied to those without one, the threshold must be shorter
+	PlatformGracePeriod time.Duration
+	// ClusterCacheSize with the number of clusters kept in the cache of the cluster alive checks
+	ClusterCacheSize int
+	// HeartbeatFlushInterval with the period at which the last alive timestamps are written to system model, written on each cluster alive check if zero
+	HeartbeatFlushInterval time.Duration
+	// HeartbeatPeriod with the period at which the clusters send their cluster alive checks, the thresholds must be longer than the flush interval plus this period
+	HeartbeatPeriod time.Duration
+	// ResyncInterval with the period of the full sweeps over the clusters of system model
+	ResyncInterval time.Duration
+	// SweepConcurrency with the number of organizations processed in parallel by a full sweep
+	SweepConcurrency int
+	// SweepTimeout with the maximum duration of a full sweep, the organizations not processed are skipped
+	SweepTimeout time.Duration
 	// Offline Policy must be set to true when a cluster is offline thus an offline policy should be triggered
 	OfflinePolicy grpc_connectivity_manager_go.OfflinePolicy
+	// PolicyFile with the path of a JSON file containing offline settings per organization and per cluster
+	PolicyFile string
+	// MaxConcurrentDrains with the maximum number of drains in flight
+	MaxConcurrentDrains int
+	// DrainInterval with the minimum time between two drains
+	DrainInterval time.Duration
+	// DrainDuration with the time a sent drain counts as in flight, as its completion is not reported back
+	DrainDuration time.Duration
+	// DrainBreakerCount with the number of clusters going offline within DrainBreakerWindow beyond which the offline policies are suppressed, zero to disable
+	DrainBreakerCount int
+	// DrainBreakerPercentage with the percentage of clusters going offline within DrainBreakerWindow beyond which the offline policies are suppressed, zero to disable
+	DrainBreakerPercentage float64
+	// DrainBreakerWindow with the period over which the clusters going offline are counted by the drain breaker
+	DrainBreakerWindow time.Duration
+	// DrainBreakerConfigMap with the Kubernetes ConfigMap where the state of the drain breaker is persisted, in LeaseNamespace, kept in memory if empty
+	DrainBreakerConfigMap string
+	// ClockSkewTolerance with the maximum difference between the timestamp of a cluster alive check and its reception
+	ClockSkewTolerance time.Duration
+	// ClusterKeysFile with the path of a JSON file containing the keys of the clusters, the cluster alive checks are not verified if empty
+	ClusterKeysFile string
+	// HeartbeatMaxAge with the maximum age of a signed cluster alive check
+	HeartbeatMaxAge time.Duration
+	// WebhookFile with the path of a JSON file containing the webhooks notified of the connectivity changes
+	WebhookFile string
+	// WebhookAttempts with the maximum number of attempts of each webhook delivery
+	WebhookAttempts int
+	// WebhookBackoff with the wait after the first failed attempt of a webhook delivery, doubled after each failure
+	WebhookBackoff time.Duration
+	// HistoryPath with the file where the connectivity history is stored, kept in memory if empty
+	HistoryPath string
+	// MaintenancePath with the file where the maintenance windows are stored, kept in memory if empty
+	MaintenancePath string
+	// MaintenanceConfigMap with the Kubernetes ConfigMap where the maintenance windows are shared by the replicas, in LeaseNamespace
+	MaintenanceConfigMap string
+	// RecoveryPolicy with the policy to uncordon the clusters that come back after being cordoned offline: none, heartbeats or window
+	RecoveryPolicy string
+	// RecoveryHeartbeats with the consecutive cluster alive checks required by the heartbeats recovery policy
+	RecoveryHeartbeats int
+	// RecoveryWindow with the stability period required by the window recovery policy
+	RecoveryWindow time.Duration
+	// Detector with the name of the failure detector used to decide when a cluster is offline: threshold or phi
+	Detector string
+	// PhiThreshold with the suspicion level over which the phi detector considers a cluster offline
+	PhiThreshold float64
+	// LeaderElection with the backend used to elect the replica that runs the expiration loop: none or kubernetes
+	LeaderElection string
+	// LeaseName with the name of the Kubernetes Lease object used for the leader election
+	LeaseName string
+	// LeaseNamespace with the namespace of the Kubernetes Lease object used for the leader election
+	LeaseNamespace string
+	// LeaseDuration with the time a leader holds the lease without renewing it
+	LeaseDuration time.Duration
+	// PeerAddress with the address of a replica, where %s is replaced by the identity of the replica, used to forward the requests served by the leader
+	PeerAddress string
 }
 
+// Validate checks the configuration, returning all the problems found at once.
 func (conf *Config) Validate() derrors.Error {
+	problems := conf.Problems()
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) == 1 {
+		return problems[0]
+	}
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	return derrors.NewInvalidArgumentError(fmt.Sprintf("%d problems found in the configuration: %s", len(problems), strings.Join(messages, "; ")))
+}
+
+// ValidFlushInterval checks that a cluster alive check is written to system model before the threshold expires,
+// as a new leader only knows the last alive timestamps written by the previous one.
+func ValidFlushInterval(flushInterval time.Duration, heartbeatPeriod time.Duration, threshold time.Duration) derrors.Error {
+	if flushInterval+heartbeatPeriod >= threshold {
+		return derrors.NewInvalidArgumentError("heartbeat flush interval plus the heartbeat period must be shorter than the threshold").
+			WithParams(flushInterval, heartbeatPeriod, threshold)
+	}
+	return nil
+}
+
+// ThresholdFloor returns the duration every threshold must exceed, so a cluster alive check is written to system
+// model before the threshold of its cluster expires.
+func (conf *Config) ThresholdFloor() time.Duration {
+	return conf.HeartbeatFlushInterval + conf.HeartbeatPeriod
+}
+
+// ValidThresholdOverrides checks the flush interval against the shortest threshold of the overrides of a store.
+func (conf *Config) ValidThresholdOverrides(store *policy.Store) derrors.Error {
+	if store == nil {
+		return nil
+	}
+	if threshold, exists := store.MinThreshold(); exists {
+		if err := ValidFlushInterval(conf.HeartbeatFlushInterval, conf.HeartbeatPeriod, threshold); err != nil {
+			return derrors.NewInvalidArgumentError("threshold override too short", err).WithParams(conf.PolicyFile)
+		}
+	}
+	return nil
+}
+
+// Problems returns all the problems found in the configuration, including the rules across several settings.
+func (conf *Config) Problems() []derrors.Error {
+	problems := make([]derrors.Error, 0)
 	if conf.Port == 0 {
-		return derrors.NewInvalidArgumentError("port must be set")
+		problems = append(problems, derrors.NewInvalidArgumentError("port must be set"))
+	}
+	if conf.MetricsPort == 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("metrics port must be set"))
+	}
+	if conf.MetricsPort == conf.Port {
+		problems = append(problems, derrors.NewInvalidArgumentError("metrics port must be different from the gRPC port"))
+	}
+	if conf.SystemModelAddress == "" {
+		problems = append(problems, derrors.NewInvalidArgumentError("system model address must be set"))
+	} else if _, _, err := net.SplitHostPort(conf.SystemModelAddress); err != nil {
+		problems = append(problems, derrors.NewInvalidArgumentError("system model address must be host:port").WithParams(conf.SystemModelAddress))
 	}
 	if conf.QueueAddress == "" {
-		return derrors.NewInvalidArgumentError("queue address must be set")
+		problems = append(problems, derrors.NewInvalidArgumentError("queue address must be set"))
+	}
+	if conf.Threshold <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("threshold must be positive"))
+	}
+	if conf.PlatformGracePeriod <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("platform grace period must be positive"))
+	} else if conf.Threshold >= conf.PlatformGracePeriod {
+		problems = append(problems, derrors.NewInvalidArgumentError("threshold must be shorter than the platform grace period").WithParams(conf.Threshold, conf.PlatformGracePeriod))
+	}
+	if _, exists := grpc_connectivity_manager_go.OfflinePolicy_name[int32(conf.OfflinePolicy)]; !exists {
+		problems = append(problems, derrors.NewInvalidArgumentError("invalid offline policy").WithParams(conf.OfflinePolicy))
+	}
+	if conf.ClusterCacheSize <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("cluster cache size must be positive"))
+	}
+	if conf.HeartbeatFlushInterval < 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("heartbeat flush interval cannot be negative").WithParams(conf.HeartbeatFlushInterval))
+	}
+	if conf.HeartbeatPeriod <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("heartbeat period must be positive"))
+	} else if err := ValidFlushInterval(conf.HeartbeatFlushInterval, conf.HeartbeatPeriod, conf.Threshold); err != nil {
+		problems = append(problems, err)
+	}
+	if conf.ResyncInterval <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("resync interval must be positive"))
+	}
+	if conf.SweepConcurrency <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("sweep concurrency must be positive"))
+	}
+	if conf.SweepTimeout <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("sweep timeout must be positive"))
+	}
+	if conf.SweepTimeout > conf.ResyncInterval {
+		problems = append(problems, derrors.NewInvalidArgumentError("sweep timeout cannot be longer than the resync interval").WithParams(conf.SweepTimeout, conf.ResyncInterval))
+	}
+	if conf.MaxConcurrentDrains <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("max concurrent drains must be positive"))
+	}
+	if conf.DrainInterval < 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("drain interval cannot be negative"))
+	}
+	if conf.DrainDuration <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("drain duration must be positive"))
+	}
+	if conf.DrainBreakerCount < 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("drain breaker count cannot be negative"))
+	}
+	if conf.DrainBreakerPercentage < 0 || conf.DrainBreakerPercentage > 100 {
+		problems = append(problems, derrors.NewInvalidArgumentError("drain breaker percentage must be between zero and one hundred").WithParams(conf.DrainBreakerPercentage))
+	}
+	if (conf.DrainBreakerCount > 0 || conf.DrainBreakerPercentage > 0) && conf.DrainBreakerWindow <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("drain breaker window must be positive"))
+	}
+	if conf.ClockSkewTolerance <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("clock skew tolerance must be positive"))
+	}
+	if conf.ClusterKeysFile != "" && conf.HeartbeatMaxAge <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("heartbeat max age must be positive when verifying the cluster alive checks"))
+	}
+	if conf.WebhookAttempts <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("webhook attempts must be positive"))
+	}
+	if conf.WebhookBackoff <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("webhook backoff must be positive"))
+	}
+	recoveryPolicy := recovery.Policy{Name: conf.RecoveryPolicy, Heartbeats: conf.RecoveryHeartbeats, Window: conf.RecoveryWindow}
+	if err := recoveryPolicy.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := detector.ValidDetector(conf.Detector); err != nil {
+		problems = append(problems, err)
+	}
+	if strings.ToLower(conf.Detector) == detector.PhiAccrual && conf.PhiThreshold <= 0 {
+		problems = append(problems, derrors.NewInvalidArgumentError("phi threshold must be positive"))
+	}
+	if err := election.ValidBackend(conf.LeaderElection); err != nil {
+		problems = append(problems, err)
+	}
+	if strings.ToLower(conf.LeaderElection) == election.Kubernetes {
+		if conf.LeaseName == "" || conf.LeaseNamespace == "" {
+			problems = append(problems, derrors.NewInvalidArgumentError("lease name and namespace must be set when using kubernetes leader election"))
+		}
+		if conf.LeaseDuration <= 0 {
+			problems = append(problems, derrors.NewInvalidArgumentError("lease duration must be positive"))
+		}
+		if strings.Count(conf.PeerAddress, "%s") != 1 {
+			problems = append(problems, derrors.NewInvalidArgumentError("peer address must contain %s once to be replaced by the identity of the leader").WithParams(conf.PeerAddress))
+		}
+	}
+	if conf.MaintenanceConfigMap != "" && conf.LeaseNamespace == "" {
+		problems = append(problems, derrors.NewInvalidArgumentError("lease namespace must be set when storing the maintenance windows in a ConfigMap"))
+	}
+	if conf.DrainBreakerConfigMap != "" && conf.LeaseNamespace == "" {
+		problems = append(problems, derrors.NewInvalidArgumentError("lease namespace must be set when storing the drain breaker state in a ConfigMap"))
+	}
+	if conf.DrainBreakerConfigMap != "" && conf.DrainBreakerConfigMap == conf.MaintenanceConfigMap {
+		problems = append(problems, derrors.NewInvalidArgumentError("drain breaker state and maintenance windows cannot be stored in the same ConfigMap").WithParams(conf.DrainBreakerConfigMap))
+	}
+	if conf.HistoryPath != "" && conf.HistoryPath == conf.MaintenancePath && conf.MaintenanceConfigMap == "" {
+		problems = append(problems, derrors.NewInvalidArgumentError("history and maintenance windows cannot be stored in the same file").WithParams(conf.HistoryPath))
 	}
 
-	return nil
+	return problems
 }
 
 func (conf *Config) Print() {
 	log.Info().Str("app", version.AppVersion).Str("commit", version.Commit).Msg("Version")
+	if conf.DryRun {
+		log.Warn().Msg("Dry run mode, no changes will be written to system model nor sent to the bus")
+	}
 	log.Info().Uint32("port", conf.Port).Msg("gRPC port")
+	log.Info().Uint32("port", conf.MetricsPort).Msg("Metrics port")
 	log.Info().Str("URL", conf.SystemModelAddress).Msg("System Model")
-	log.Info().Dur("threshold", conf.Threshold).Msg("Threshold")
-	log.Info().Str("offline policy", conf.OfflinePolicy.String()).Msg("Offline policy")
+	log.Info().Dur("threshold", conf.Threshold).Dur("platform grace period", conf.PlatformGracePeriod).Msg("Threshold")
+	log.Info().Int("size", conf.ClusterCacheSize).Dur("flush interval", conf.HeartbeatFlushInterval).Dur("heartbeat period", conf.HeartbeatPeriod).Msg("Cluster cache")
+	log.Info().Dur("interval", conf.ResyncInterval).Int("concurrency", conf.SweepConcurrency).Dur("timeout", conf.SweepTimeout).Msg("Full resync")
+	log.Info().Str("offline policy", conf.OfflinePolicy.String()).Str("overrides", conf.PolicyFile).Msg("Offline policy")
+	log.Info().Int("max concurrent", conf.MaxConcurrentDrains).Dur("interval", conf.DrainInterval).Dur("duration", conf.DrainDuration).Msg("Drain queue")
+	log.Info().Int("count", conf.DrainBreakerCount).Float64("percentage", conf.DrainBreakerPercentage).Dur("window", conf.DrainBreakerWindow).Str("configMap", conf.DrainBreakerConfigMap).Msg("Drain breaker")
+	log.Info().Str("policy", conf.RecoveryPolicy).Int("heartbeats", conf.RecoveryHeartbeats).Dur("window", conf.RecoveryWindow).Msg("Recovery policy")
+	log.Info().Dur("tolerance", conf.ClockSkewTolerance).Msg("Clock skew")
+	log.Info().Str("keys", conf.ClusterKeysFile).Dur("max age", conf.HeartbeatMaxAge).Msg("Cluster alive verification")
+	log.Info().Str("file", conf.WebhookFile).Int("attempts", conf.WebhookAttempts).Dur("backoff", conf.WebhookBackoff).Msg("Webhooks")
+	log.Info().Str("path", conf.HistoryPath).Msg("Connectivity history")
+	log.Info().Str("path", conf.MaintenancePath).Str("configMap", conf.MaintenanceConfigMap).Msg("Maintenance windows")
+	log.Info().Str("detector", conf.Detector).Float64("phi threshold", conf.PhiThreshold).Msg("Failure detector")
+	log.Info().Str("backend", conf.LeaderElection).Str("lease", conf.LeaseName).Str("namespace", conf.LeaseNamespace).Dur("duration", conf.LeaseDuration).Str("peer address", conf.PeerAddress).Msg("Leader election")
 }
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/nalej/connectivity-manager/pkg/detector"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/policy"
+	"github.com/nalej/connectivity-manager/pkg/recovery"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+	"strings"
+	"time"
+)
+
+// validConfig returns a configuration without problems.
+func validConfig() Config {
+	return Config{
+		Port:                   8383,
+		MetricsPort:            8384,
+		SystemModelAddress:     "localhost:8800",
+		QueueAddress:           "localhost:6650",
+		Threshold:              90 * time.Second,
+		PlatformGracePeriod:    120 * time.Second,
+		ClusterCacheSize:       100,
+		HeartbeatFlushInterval: 30 * time.Second,
+		HeartbeatPeriod:        15 * time.Second,
+		ResyncInterval:         time.Minute,
+		SweepConcurrency:       4,
+		SweepTimeout:           30 * time.Second,
+		OfflinePolicy:          grpc_connectivity_manager_go.OfflinePolicy_DRAIN,
+		MaxConcurrentDrains:    5,
+		DrainInterval:          10 * time.Second,
+		DrainDuration:          5 * time.Minute,
+		ClockSkewTolerance:     30 * time.Second,
+		WebhookAttempts:        5,
+		WebhookBackoff:         time.Second,
+		RecoveryPolicy:         recovery.None,
+		Detector:               detector.Threshold,
+		PhiThreshold:           detector.DefaultPhiThreshold,
+		LeaderElection:         election.None,
+	}
+}
+
+// messages returns the messages of the problems of a configuration.
+func messages(conf Config) []string {
+	result := make([]string, 0)
+	for _, problem := range conf.Problems() {
+		result = append(result, problem.Error())
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("Configuration", func() {
+
+	ginkgo.It("should not find problems in a valid configuration", func() {
+		conf := validConfig()
+		gomega.Expect(conf.Problems()).To(gomega.BeEmpty())
+		gomega.Expect(conf.Validate()).To(gomega.Succeed())
+	})
+
+	table.DescribeTable("problems",
+		func(modify func(conf *Config), expected string) {
+			conf := validConfig()
+			modify(&conf)
+			found := messages(conf)
+			gomega.Expect(found).To(gomega.HaveLen(1))
+			gomega.Expect(found[0]).To(gomega.ContainSubstring(expected))
+		},
+		table.Entry("without port", func(conf *Config) {
+			conf.Port = 0
+		}, "port must be set"),
+		table.Entry("with the same gRPC and metrics port", func(conf *Config) {
+			conf.MetricsPort = conf.Port
+		}, "metrics port must be different"),
+		table.Entry("with an invalid system model address", func(conf *Config) {
+			conf.SystemModelAddress = "localhost"
+		}, "system model address must be host:port"),
+		table.Entry("with a threshold not shorter than the platform grace period", func(conf *Config) {
+			conf.PlatformGracePeriod = conf.Threshold
+		}, "threshold must be shorter than the platform grace period"),
+		table.Entry("with an invalid offline policy", func(conf *Config) {
+			conf.OfflinePolicy = grpc_connectivity_manager_go.OfflinePolicy(100)
+		}, "invalid offline policy"),
+		table.Entry("with a flush interval plus the heartbeat period not shorter than the threshold", func(conf *Config) {
+			conf.HeartbeatFlushInterval = conf.Threshold - conf.HeartbeatPeriod
+		}, "heartbeat flush interval plus the heartbeat period"),
+		table.Entry("without heartbeat period", func(conf *Config) {
+			conf.HeartbeatPeriod = 0
+		}, "heartbeat period must be positive"),
+		table.Entry("with a sweep timeout longer than the resync interval", func(conf *Config) {
+			conf.SweepTimeout = 2 * conf.ResyncInterval
+		}, "sweep timeout cannot be longer than the resync interval"),
+		table.Entry("with a drain breaker percentage over one hundred", func(conf *Config) {
+			conf.DrainBreakerPercentage = 101
+			conf.DrainBreakerWindow = time.Minute
+		}, "drain breaker percentage"),
+		table.Entry("with a drain breaker without window", func(conf *Config) {
+			conf.DrainBreakerCount = 10
+		}, "drain breaker window must be positive"),
+		table.Entry("with cluster keys without max age", func(conf *Config) {
+			conf.ClusterKeysFile = "keys.json"
+		}, "heartbeat max age must be positive"),
+		table.Entry("with an invalid recovery policy", func(conf *Config) {
+			conf.RecoveryPolicy = "other"
+		}, "recovery"),
+		table.Entry("with an invalid detector", func(conf *Config) {
+			conf.Detector = "other"
+		}, "invalid detector"),
+		table.Entry("with the phi detector without threshold", func(conf *Config) {
+			conf.Detector = detector.PhiAccrual
+			conf.PhiThreshold = 0
+		}, "phi threshold must be positive"),
+		table.Entry("with an invalid peer address", func(conf *Config) {
+			conf.LeaderElection = election.Kubernetes
+			conf.LeaseName = "connectivity-manager"
+			conf.LeaseNamespace = "nalej"
+			conf.LeaseDuration = 15 * time.Second
+			conf.PeerAddress = "connectivity-manager:8383"
+		}, "peer address must contain %s once"),
+		table.Entry("with the maintenance windows in a ConfigMap without namespace", func(conf *Config) {
+			conf.MaintenanceConfigMap = "maintenance"
+		}, "lease namespace must be set when storing the maintenance windows"),
+		table.Entry("with the drain breaker state in a ConfigMap without namespace", func(conf *Config) {
+			conf.DrainBreakerConfigMap = "breaker"
+		}, "lease namespace must be set when storing the drain breaker state"),
+		table.Entry("with the drain breaker state and the maintenance windows in the same ConfigMap", func(conf *Config) {
+			conf.LeaseNamespace = "nalej"
+			conf.MaintenanceConfigMap = "shared"
+			conf.DrainBreakerConfigMap = "shared"
+		}, "cannot be stored in the same ConfigMap"),
+		table.Entry("with the history and the maintenance windows in the same file", func(conf *Config) {
+			conf.HistoryPath = "/data/connectivity.db"
+			conf.MaintenancePath = "/data/connectivity.db"
+		}, "cannot be stored in the same file"),
+	)
+
+	ginkgo.It("should return all the problems at once", func() {
+		conf := validConfig()
+		conf.Port = 0
+		conf.QueueAddress = ""
+		conf.SweepConcurrency = 0
+		found := messages(conf)
+		gomega.Expect(found).To(gomega.HaveLen(3))
+		err := conf.Validate()
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("3 problems found"))
+		for _, message := range found {
+			gomega.Expect(strings.Contains(err.Error(), message)).To(gomega.BeTrue())
+		}
+	})
+
+	table.DescribeTable("flush interval",
+		func(flushInterval time.Duration, heartbeatPeriod time.Duration, threshold time.Duration, valid bool) {
+			err := ValidFlushInterval(flushInterval, heartbeatPeriod, threshold)
+			if valid {
+				gomega.Expect(err).To(gomega.Succeed())
+			} else {
+				gomega.Expect(err).NotTo(gomega.Succeed())
+			}
+		},
+		table.Entry("written on each check", time.Duration(0), 15*time.Second, 90*time.Second, true),
+		table.Entry("shorter than the threshold", 30*time.Second, 15*time.Second, 90*time.Second, true),
+		table.Entry("equal to the threshold", 75*time.Second, 15*time.Second, 90*time.Second, false),
+		table.Entry("longer than the threshold", 90*time.Second, 15*time.Second, 90*time.Second, false),
+	)
+
+	table.DescribeTable("threshold overrides",
+		func(threshold string, valid bool) {
+			conf := validConfig()
+			store := policy.NewStore()
+			store.Organizations["org"] = policy.Override{Threshold: threshold}
+			err := conf.ValidThresholdOverrides(store)
+			if valid {
+				gomega.Expect(err).To(gomega.Succeed())
+			} else {
+				gomega.Expect(err).NotTo(gomega.Succeed())
+			}
+		},
+		table.Entry("not overridden", "", true),
+		table.Entry("longer than the floor", "2m", true),
+		table.Entry("shorter than the floor", "20s", false),
+	)
+})
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/nalej/derrors"
+	"io/ioutil"
+	"reflect"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the settings.
+const EnvPrefix = "CM_"
+
+// Reloadable contains the names of the settings applied by a hot reload, the rest require a restart.
+var Reloadable = []string{
+	"Threshold",
+	"PlatformGracePeriod",
+	"HeartbeatPeriod",
+	"OfflinePolicy",
+	"PolicyFile",
+	"RecoveryPolicy",
+	"RecoveryHeartbeats",
+	"RecoveryWindow",
+	"ClockSkewTolerance",
+	"SweepConcurrency",
+	"SweepTimeout",
+	"MaxConcurrentDrains",
+	"DrainInterval",
+	"DrainDuration",
+	"DrainBreakerCount",
+	"DrainBreakerPercentage",
+	"DrainBreakerWindow",
+}
+
+// EnvName returns the environment variable of a setting given its flag name, for instance CM_CLUSTER_CACHE_SIZE
+// for clusterCacheSize.
+func EnvName(flag string) string {
+	var result strings.Builder
+	result.WriteString(EnvPrefix)
+	for index, r := range flag {
+		if unicode.IsUpper(r) && index > 0 {
+			result.WriteRune('_')
+		}
+		result.WriteRune(unicode.ToUpper(r))
+	}
+	return result.String()
+}
+
+// ReadFile reads a YAML configuration file with the settings indexed by their flag name. The values are returned
+// as they would be set in the command line.
+func ReadFile(path string) (map[string]string, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read configuration file")
+	}
+	settings := make(map[string]interface{}, 0)
+	if err := yaml.Unmarshal(content, &settings); err != nil {
+		return nil, derrors.AsError(err, "cannot parse configuration file")
+	}
+	result := make(map[string]string, len(settings))
+	for name, value := range settings {
+		switch v := value.(type) {
+		case string:
+			result[name] = v
+		case bool:
+			result[name] = strconv.FormatBool(v)
+		case float64:
+			result[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, derrors.NewInvalidArgumentError("invalid value in configuration file, expecting a string, a number or a boolean").WithParams(name)
+		}
+	}
+	return result, nil
+}
+
+// WithReloadable returns the configuration with the reloadable settings of another one.
+func (conf Config) WithReloadable(next Config) Config {
+	result := reflect.ValueOf(&conf).Elem()
+	source := reflect.ValueOf(next)
+	for _, name := range Reloadable {
+		result.FieldByName(name).Set(source.FieldByName(name))
+	}
+	return conf
+}
+
+// RestartRequired returns the names of the settings that differ between two configurations and are not
+// applied by a hot reload.
+func RestartRequired(current Config, next Config) []string {
+	result := make([]string, 0)
+	applied := reflect.ValueOf(current.WithReloadable(next))
+	expected := reflect.ValueOf(next)
+	for index := 0; index < applied.NumField(); index++ {
+		if applied.Field(index).Interface() != expected.Field(index).Interface() {
+			result = append(result, applied.Type().Field(index).Name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectivity_manager
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/nalej/grpc-infrastructure-go"
+	"sync"
+	"time"
+)
+
+// cachedCluster is a cluster as last read from system model, with the status and the last alive timestamp
+// updated by the cluster alive checks.
+type cachedCluster struct {
+	cluster *grpc_infrastructure_go.Cluster
+	// fetched with the time the cluster was read from system model
+	fetched time.Time
+	// written with the last alive timestamp stored in system model
+	written int64
+}
+
+// pendingTimestamp is a last alive timestamp not yet stored in system model.
+type pendingTimestamp struct {
+	key            string
+	organizationID string
+	clusterID      string
+	lastAlive      int64
+}
+
+// clusterCache is a write-behind cache of the clusters receiving cluster alive checks. The status changes are
+// written to system model immediately, while the last alive timestamps are written in batches. The cached
+// clusters are read again from system model after the ttl, to see the status changes applied by other
+// replicas. A zero ttl disables the cache.
+type clusterCache struct {
+	sync.Mutex
+	entries *simplelru.LRU
+	ttl     time.Duration
+	// evicted with the timestamps of the clusters evicted before being written
+	evicted []pendingTimestamp
+}
+
+func newClusterCache(size int, ttl time.Duration) (*clusterCache, derrors.Error) {
+	cache := &clusterCache{ttl: ttl, evicted: make([]pendingTimestamp, 0)}
+	entries, err := simplelru.NewLRU(size, cache.onEvict)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create cluster cache")
+	}
+	cache.entries = entries
+	return cache, nil
+}
+
+// enabled returns true if the timestamps are written in batches.
+func (c *clusterCache) enabled() bool {
+	return c.ttl > 0
+}
+
+// onEvict keeps the timestamp of an evicted cluster to be written on the next flush. It is called with the
+// lock held.
+func (c *clusterCache) onEvict(key interface{}, value interface{}) {
+	entry := value.(*cachedCluster)
+	if entry.cluster.LastAliveTimestamp > entry.written {
+		c.evicted = append(c.evicted, pendingTimestamp{
+			key:            key.(string),
+			organizationID: entry.cluster.OrganizationId,
+			clusterID:      entry.cluster.ClusterId,
+			lastAlive:      entry.cluster.LastAliveTimestamp,
+		})
+	}
+}
+
+// get returns a copy of a cached cluster if it was read from system model within the ttl.
+func (c *clusterCache) get(key string, now time.Time) (*grpc_infrastructure_go.Cluster, bool) {
+	c.Lock()
+	defer c.Unlock()
+	value, exists := c.entries.Get(key)
+	if !exists || now.Sub(value.(*cachedCluster).fetched) >= c.ttl {
+		return nil, false
+	}
+	return proto.Clone(value.(*cachedCluster).cluster).(*grpc_infrastructure_go.Cluster), true
+}
+
+// put caches a cluster just read from system model. A newer pending timestamp of the cluster is kept.
+func (c *clusterCache) put(key string, cluster *grpc_infrastructure_go.Cluster, now time.Time) {
+	if c.ttl == 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	entry := &cachedCluster{
+		cluster: proto.Clone(cluster).(*grpc_infrastructure_go.Cluster),
+		fetched: now,
+		written: cluster.LastAliveTimestamp,
+	}
+	if value, exists := c.entries.Peek(key); exists && value.(*cachedCluster).cluster.LastAliveTimestamp > cluster.LastAliveTimestamp {
+		entry.cluster.LastAliveTimestamp = value.(*cachedCluster).cluster.LastAliveTimestamp
+	}
+	// take back the timestamp of the cluster if it was evicted before being written
+	for index, evicted := range c.evicted {
+		if evicted.key == key {
+			if evicted.lastAlive > entry.cluster.LastAliveTimestamp {
+				entry.cluster.LastAliveTimestamp = evicted.lastAlive
+			}
+			c.evicted = append(c.evicted[:index], c.evicted[index+1:]...)
+			break
+		}
+	}
+	c.entries.Add(key, entry)
+}
+
+// update records a processed cluster alive check. If written is false, the timestamp is written on the next flush.
+func (c *clusterCache) update(key string, status grpc_connectivity_manager_go.ClusterStatus, lastAlive int64, written bool) {
+	c.Lock()
+	defer c.Unlock()
+	value, exists := c.entries.Peek(key)
+	if !exists {
+		return
+	}
+	entry := value.(*cachedCluster)
+	entry.cluster.ClusterStatus = status
+	if lastAlive > entry.cluster.LastAliveTimestamp {
+		entry.cluster.LastAliveTimestamp = lastAlive
+	}
+	if written && lastAlive > entry.written {
+		entry.written = lastAlive
+	}
+}
+
+// setStatus records a status change applied by the manager.
+func (c *clusterCache) setStatus(key string, status grpc_connectivity_manager_go.ClusterStatus) {
+	c.Lock()
+	defer c.Unlock()
+	if value, exists := c.entries.Peek(key); exists {
+		value.(*cachedCluster).cluster.ClusterStatus = status
+	}
+}
+
+// setLabels records the labels added or removed by the manager.
+func (c *clusterCache) setLabels(key string, labels map[string]string, remove bool) {
+	c.Lock()
+	defer c.Unlock()
+	if value, exists := c.entries.Peek(key); exists {
+		applyLabels(value.(*cachedCluster).cluster, labels, remove)
+	}
+}
+
+// lastAlive returns the latest last alive timestamp of a cluster known by the cache, zero if not cached.
+func (c *clusterCache) lastAlive(key string) int64 {
+	c.Lock()
+	defer c.Unlock()
+	if value, exists := c.entries.Peek(key); exists {
+		return value.(*cachedCluster).cluster.LastAliveTimestamp
+	}
+	return 0
+}
+
+// pending returns the timestamps that have not been written to system model, including those of the evicted
+// clusters. The timestamps of the evicted clusters are kept until they are written.
+func (c *clusterCache) pending() []pendingTimestamp {
+	c.Lock()
+	defer c.Unlock()
+	result := append(make([]pendingTimestamp, 0, len(c.evicted)), c.evicted...)
+	for _, key := range c.entries.Keys() {
+		value, _ := c.entries.Peek(key)
+		entry := value.(*cachedCluster)
+		if entry.cluster.LastAliveTimestamp > entry.written {
+			result = append(result, pendingTimestamp{
+				key:            key.(string),
+				organizationID: entry.cluster.OrganizationId,
+				clusterID:      entry.cluster.ClusterId,
+				lastAlive:      entry.cluster.LastAliveTimestamp,
+			})
+		}
+	}
+	return result
+}
+
+// written records a timestamp stored in system model, discarding the timestamp of the evicted cluster it covers.
+func (c *clusterCache) written(key string, lastAlive int64) {
+	c.Lock()
+	defer c.Unlock()
+	if value, exists := c.entries.Peek(key); exists && lastAlive > value.(*cachedCluster).written {
+		value.(*cachedCluster).written = lastAlive
+	}
+	for index, evicted := range c.evicted {
+		if evicted.key == key && evicted.lastAlive <= lastAlive {
+			c.evicted = append(c.evicted[:index], c.evicted[index+1:]...)
+			break
+		}
+	}
+}
+
+// remove discards a cached cluster.
+func (c *clusterCache) remove(key string) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries.Remove(key)
+}
+
+// clear discards all the cached clusters, including the timestamps not yet written.
+func (c *clusterCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.entries.Purge()
+	c.evicted = make([]pendingTimestamp, 0)
+}
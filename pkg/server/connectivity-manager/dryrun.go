@@ -0,0 +1,173 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectivity_manager
+
+import (
+	"github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// simulatedCluster with the changes a dry run would have written to system model.
+type simulatedCluster struct {
+	status    grpc_connectivity_manager_go.ClusterStatus
+	hasStatus bool
+	lastAlive int64
+	// labels with the labels added, or removed if empty
+	labels map[string]string
+}
+
+type transitionKey struct {
+	from grpc_connectivity_manager_go.ClusterStatus
+	to   grpc_connectivity_manager_go.ClusterStatus
+}
+
+// dryRun keeps the changes that are not written in dry run mode, so the following decisions are taken on the
+// simulated state as if they had been written, and counts the actions that were not performed.
+type dryRun struct {
+	sync.Mutex
+	started       time.Time
+	clusters      map[string]simulatedCluster
+	transitions   map[transitionKey]int64
+	updates       int64
+	drains        int64
+	uncordons     int64
+	events        int64
+	notifications int64
+}
+
+func newDryRun(started time.Time) *dryRun {
+	return &dryRun{
+		started:     started,
+		clusters:    make(map[string]simulatedCluster, 0),
+		transitions: make(map[transitionKey]int64, 0),
+	}
+}
+
+// update records a cluster update instead of sending it to system model.
+func (d *dryRun) update(request *grpc_infrastructure_go.UpdateClusterRequest) {
+	d.Lock()
+	defer d.Unlock()
+	key := clusterKey(request.OrganizationId, request.ClusterId)
+	simulated := d.clusters[key]
+	if request.UpdateStatus {
+		simulated.status = request.Status
+		simulated.hasStatus = true
+		log.Info().Str("organizationID", request.OrganizationId).Str("clusterID", request.ClusterId).
+			Str("status", request.Status.String()).Msg("dry run, would update cluster status")
+	} else {
+		log.Debug().Str("organizationID", request.OrganizationId).Str("clusterID", request.ClusterId).
+			Int64("lastAlive", request.LastClusterTimestamp).Msg("dry run, would update cluster last alive timestamp")
+	}
+	if request.UpdateLastClusterTimestamp && request.LastClusterTimestamp > simulated.lastAlive {
+		simulated.lastAlive = request.LastClusterTimestamp
+	}
+	if request.AddLabels || request.RemoveLabels {
+		if simulated.labels == nil {
+			simulated.labels = make(map[string]string, len(request.Labels))
+		}
+		for name, value := range request.Labels {
+			if request.RemoveLabels {
+				value = ""
+			}
+			simulated.labels[name] = value
+		}
+	}
+	d.clusters[key] = simulated
+	d.updates++
+}
+
+// apply overwrites a cluster read from system model with the simulated changes.
+func (d *dryRun) apply(cluster *grpc_infrastructure_go.Cluster) {
+	d.Lock()
+	defer d.Unlock()
+	simulated, exists := d.clusters[clusterKey(cluster.OrganizationId, cluster.ClusterId)]
+	if !exists {
+		return
+	}
+	if simulated.hasStatus {
+		cluster.ClusterStatus = simulated.status
+	}
+	if simulated.lastAlive > cluster.LastAliveTimestamp {
+		cluster.LastAliveTimestamp = simulated.lastAlive
+	}
+	for name, value := range simulated.labels {
+		applyLabels(cluster, map[string]string{name: value}, value == "")
+	}
+}
+
+func (d *dryRun) transition(from grpc_connectivity_manager_go.ClusterStatus, to grpc_connectivity_manager_go.ClusterStatus) {
+	d.Lock()
+	defer d.Unlock()
+	d.transitions[transitionKey{from: from, to: to}]++
+}
+
+func (d *dryRun) drain() {
+	d.Lock()
+	defer d.Unlock()
+	d.drains++
+}
+
+func (d *dryRun) uncordon() {
+	d.Lock()
+	defer d.Unlock()
+	d.uncordons++
+}
+
+func (d *dryRun) event() {
+	d.Lock()
+	defer d.Unlock()
+	d.events++
+}
+
+func (d *dryRun) notification() {
+	d.Lock()
+	defer d.Unlock()
+	d.notifications++
+}
+
+// summary returns the actions that were not performed since the start.
+func (d *dryRun) summary() *grpc_connectivity_manager_go.DryRunSummary {
+	d.Lock()
+	defer d.Unlock()
+	result := &grpc_connectivity_manager_go.DryRunSummary{
+		StartedTimestamp: d.started.Unix(),
+		Updates:          d.updates,
+		Drains:           d.drains,
+		Uncordons:        d.uncordons,
+		Events:           d.events,
+		Notifications:    d.notifications,
+		Transitions:      make([]*grpc_connectivity_manager_go.TransitionCount, 0, len(d.transitions)),
+	}
+	for transition, count := range d.transitions {
+		result.Transitions = append(result.Transitions, &grpc_connectivity_manager_go.TransitionCount{
+			From:  transition.from,
+			To:    transition.to,
+			Count: count,
+		})
+	}
+	sort.Slice(result.Transitions, func(i, j int) bool {
+		if result.Transitions[i].From != result.Transitions[j].From {
+			return result.Transitions[i].From < result.Transitions[j].From
+		}
+		return result.Transitions[i].To < result.Transitions[j].To
+	})
+	return result
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectivity_manager
+
+import (
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-connectivity-manager-go"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// leaderForwarder sends the requests that must be served by the leader replica to it.
+type leaderForwarder struct {
+	sync.Mutex
+	elector election.Elector
+	// addressFormat with the address of a replica, where %s is replaced by its identity
+	addressFormat string
+	// connections with the connections opened to the replicas, by address
+	connections map[string]*grpc.ClientConn
+}
+
+func newLeaderForwarder(elector election.Elector, addressFormat string) *leaderForwarder {
+	return &leaderForwarder{
+		elector:       elector,
+		addressFormat: addressFormat,
+		connections:   make(map[string]*grpc.ClientConn, 0),
+	}
+}
+
+// leader returns a client of the leader replica, or nil if the request must be served locally because this
+// replica is the leader.
+func (f *leaderForwarder) leader() (grpc_connectivity_manager_go.ConnectivityManagerClient, derrors.Error) {
+	if f.elector.IsLeader() {
+		return nil, nil
+	}
+	identity := f.elector.Leader()
+	if identity == "" {
+		return nil, derrors.NewUnavailableError("the leader replica is not known yet, retry the request")
+	}
+	address := fmt.Sprintf(f.addressFormat, identity)
+	f.Lock()
+	defer f.Unlock()
+	conn, exists := f.connections[address]
+	if !exists {
+		var err error
+		conn, err = grpc.Dial(address, grpc.WithInsecure())
+		if err != nil {
+			return nil, derrors.AsError(err, "cannot create connection with the leader replica").WithParams(address)
+		}
+		f.connections[address] = conn
+	}
+	return grpc_connectivity_manager_go.NewConnectivityManagerClient(conn), nil
+}
+
+// close the connections opened to the replicas.
+func (f *leaderForwarder) close() {
+	f.Lock()
+	defer f.Unlock()
+	for address, conn := range f.connections {
+		conn.Close()
+		delete(f.connections, address)
+	}
+}
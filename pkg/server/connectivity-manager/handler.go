@@ -16,10 +16,260 @@
 
 package connectivity_manager
 
+import (
+	"context"
+	"github.com/nalej/connectivity-manager/pkg/entities"
+	grpc_common_go "github.com/nalej/grpc-common-go"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	grpc_infrastructure_go "github.com/nalej/grpc-infrastructure-go"
+	grpc_organization_go "github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+)
+
+// Handler structure for the connectivity manager requests.
 type Handler struct {
-	Manager Manager
+	Manager *Manager
 }
 
-func NewHandler(manager Manager) *Handler {
+// NewHandler creates a new Handler with a linked manager.
+func NewHandler(manager *Manager) *Handler {
 	return &Handler{manager}
 }
+
+// GetClusterConnectivity retrieves the connectivity information of a given cluster.
+func (h *Handler) GetClusterConnectivity(ctx context.Context, clusterID *grpc_infrastructure_go.ClusterId) (*grpc_connectivity_manager_go.ClusterConnectivity, error) {
+	vErr := entities.ValidClusterId(clusterID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	connectivity, err := h.Manager.GetClusterConnectivity(clusterID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return connectivity, nil
+}
+
+// ListClusterConnectivity retrieves the connectivity information of all the clusters of an organization.
+func (h *Handler) ListClusterConnectivity(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_connectivity_manager_go.ClusterConnectivityList, error) {
+	vErr := entities.ValidOrganizationId(organizationID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	list, err := h.Manager.ListClusterConnectivity(organizationID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
+
+// ListClusterHistory retrieves the connectivity history of the clusters filtered by organization, cluster and time range
+// from the leader, as it is the only replica recording it.
+func (h *Handler) ListClusterHistory(ctx context.Context, request *grpc_connectivity_manager_go.ClusterHistoryRequest) (*grpc_connectivity_manager_go.ClusterHistory, error) {
+	vErr := entities.ValidClusterHistoryRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.ListClusterHistory(ctx, request)
+	}
+	result, err := h.Manager.ListClusterHistory(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
+
+// GetConnectivityReport computes the uptime, outages, MTTR and longest outage of the clusters of an organization over a period
+// on the leader, as it is the only replica recording the connectivity history.
+func (h *Handler) GetConnectivityReport(ctx context.Context, request *grpc_connectivity_manager_go.ConnectivityReportRequest) (*grpc_connectivity_manager_go.ConnectivityReport, error) {
+	vErr := entities.ValidConnectivityReportRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.GetConnectivityReport(ctx, request)
+	}
+	result, err := h.Manager.GetConnectivityReport(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return result, nil
+}
+
+// AddMaintenanceWindow creates a maintenance window for a cluster or for all the clusters of an organization on
+// the leader, as it is the replica applying the windows.
+func (h *Handler) AddMaintenanceWindow(ctx context.Context, request *grpc_connectivity_manager_go.AddMaintenanceWindowRequest) (*grpc_connectivity_manager_go.MaintenanceWindow, error) {
+	vErr := entities.ValidAddMaintenanceWindowRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.AddMaintenanceWindow(ctx, request)
+	}
+	window, err := h.Manager.AddMaintenanceWindow(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return window, nil
+}
+
+// ListMaintenanceWindows retrieves the maintenance windows of an organization, or those covering a cluster, from
+// the leader.
+func (h *Handler) ListMaintenanceWindows(ctx context.Context, request *grpc_connectivity_manager_go.MaintenanceWindowListRequest) (*grpc_connectivity_manager_go.MaintenanceWindowList, error) {
+	vErr := entities.ValidMaintenanceWindowListRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.ListMaintenanceWindows(ctx, request)
+	}
+	list, err := h.Manager.ListMaintenanceWindows(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
+
+// RemoveMaintenanceWindow deletes a maintenance window on the leader.
+func (h *Handler) RemoveMaintenanceWindow(ctx context.Context, windowID *grpc_connectivity_manager_go.MaintenanceWindowId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidMaintenanceWindowId(windowID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.RemoveMaintenanceWindow(ctx, windowID)
+	}
+	err := h.Manager.RemoveMaintenanceWindow(windowID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListNotificationDeliveries retrieves the last webhook deliveries of an organization from the leader, as it
+// is the only replica notifying the webhooks.
+func (h *Handler) ListNotificationDeliveries(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_connectivity_manager_go.NotificationDeliveryList, error) {
+	vErr := entities.ValidOrganizationId(organizationID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.ListNotificationDeliveries(ctx, organizationID)
+	}
+	list, err := h.Manager.ListNotificationDeliveries(organizationID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
+
+// GetDrainBreaker retrieves the status of the drain breaker from the leader.
+func (h *Handler) GetDrainBreaker(ctx context.Context, empty *grpc_common_go.Empty) (*grpc_connectivity_manager_go.DrainBreaker, error) {
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.GetDrainBreaker(ctx, empty)
+	}
+	status, err := h.Manager.GetDrainBreaker()
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return status, nil
+}
+
+// ReleaseDrainBreaker closes the drain breaker opened by a suspected partition of the management cluster on the leader.
+func (h *Handler) ReleaseDrainBreaker(ctx context.Context, request *grpc_connectivity_manager_go.ReleaseDrainBreakerRequest) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidReleaseDrainBreakerRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.ReleaseDrainBreaker(ctx, request)
+	}
+	err := h.Manager.ReleaseDrainBreaker(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListPendingDrains retrieves the drains of an organization waiting in the drain queue and those in flight from
+// the leader, as it is the only replica sending them.
+func (h *Handler) ListPendingDrains(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_connectivity_manager_go.PendingDrainList, error) {
+	vErr := entities.ValidOrganizationId(organizationID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.ListPendingDrains(ctx, organizationID)
+	}
+	list, err := h.Manager.ListPendingDrains(organizationID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
+
+// GetDryRunSummary retrieves the actions not performed in dry run mode.
+func (h *Handler) GetDryRunSummary(ctx context.Context, empty *grpc_common_go.Empty) (*grpc_connectivity_manager_go.DryRunSummary, error) {
+	summary, err := h.Manager.GetDryRunSummary()
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return summary, nil
+}
+
+// ClusterAlive processes a cluster alive check synchronously. The check is forwarded to the leader, as the
+// other replicas do not write it to system model.
+func (h *Handler) ClusterAlive(ctx context.Context, alive *grpc_connectivity_manager_go.ClusterAlive) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidClusterAlive(alive)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	leader, fErr := h.Manager.forwarder.leader()
+	if fErr != nil {
+		return nil, conversions.ToGRPCError(fErr)
+	}
+	if leader != nil {
+		return leader.ClusterAlive(ctx, alive)
+	}
+	err := h.Manager.ClusterAlive(alive)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &grpc_common_go.Success{}, nil
+}
@@ -18,7 +18,25 @@ package connectivity_manager
 
 import (
 	"context"
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/authentication"
+	"github.com/nalej/connectivity-manager/pkg/breaker"
+	"github.com/nalej/connectivity-manager/pkg/bus"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/connectivity-manager/pkg/detector"
+	"github.com/nalej/connectivity-manager/pkg/drain"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/history"
+	"github.com/nalej/connectivity-manager/pkg/maintenance"
+	"github.com/nalej/connectivity-manager/pkg/metrics"
+	"github.com/nalej/connectivity-manager/pkg/notification"
+	"github.com/nalej/connectivity-manager/pkg/policy"
+	"github.com/nalej/connectivity-manager/pkg/recovery"
+	"github.com/nalej/connectivity-manager/pkg/report"
+	"github.com/nalej/connectivity-manager/pkg/scheduler"
 	"github.com/nalej/connectivity-manager/pkg/server/config"
+	"github.com/nalej/connectivity-manager/pkg/skew"
+	"github.com/nalej/connectivity-manager/pkg/statemachine"
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
 	grpc_conductor_go "github.com/nalej/grpc-conductor-go"
@@ -26,189 +44,1401 @@ import (
 	"github.com/nalej/grpc-infrastructure-go"
 	"github.com/nalej/grpc-organization-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
-	"github.com/nalej/nalej-bus/pkg/queue/infrastructure/events"
-	"github.com/nalej/nalej-bus/pkg/queue/infrastructure/ops"
 	"github.com/rs/zerolog/log"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	DefaultTimeout = 2 * time.Minute
+	// MaintenanceReason is recorded in the history when an offline policy is skipped by a maintenance window.
+	MaintenanceReason = "maintenance"
+	// SuspectedPartitionReason is recorded in the history when an offline policy is suppressed by the drain breaker.
+	SuspectedPartitionReason = "suspected_partition"
+	dryRunMaintenance        = "maintenance windows cannot be changed in dry run mode, they are shared with the production deployment"
 )
 
 // Manager structure with the remote clients required
 type Manager struct {
 	OrganizationsClient          grpc_organization_go.OrganizationsClient
 	ClustersClient               grpc_infrastructure_go.ClustersClient
-	InfrastructureOpsProducer    *ops.InfrastructureOpsProducer
-	InfrastructureEventsConsumer *events.InfrastructureEventsConsumer
+	InfrastructureOpsProducer    bus.Producer
+	InfrastructureEventsConsumer bus.ClusterAliveConsumer
+	InfrastructureEventsProducer bus.Producer
 	config                       config.Config
+	configLock                   sync.RWMutex
+	stateMachine                 *statemachine.StateMachine
+	detector                     detector.Detector
+	recovery                     *recovery.Tracker
+	policies                     *policy.Resolver
+	clock                        clock.Clock
+	history                      history.Store
+	expirations                  *scheduler.Scheduler
+	maintenance                  maintenance.Store
+	notifier                     *notification.Notifier
+	verifier                     *authentication.Verifier
+	skews                        *skew.Tracker
+	sequence                     *heartbeatSequence
+	cache                        *clusterCache
+	breaker                      *breaker.Breaker
+	breakerStore                 breaker.Store
+	drains                       *drain.Queue
+	dryRun                       *dryRun
+	elector                      election.Elector
+	forwarder                    *leaderForwarder
+	resync                       int32
+	// observed with the clusters that sent cluster alive checks, to forget them once they are no longer listed
+	observed     map[string]*grpc_infrastructure_go.ClusterId
+	observedLock sync.Mutex
 }
 
 // NewManager creates a new manager.
 func NewManager(clustersClient *grpc_infrastructure_go.ClustersClient,
 	organizationsClient *grpc_organization_go.OrganizationsClient,
-	infrastructureEventsConsumer *events.InfrastructureEventsConsumer,
-	infrastructureOpsProducer *ops.InfrastructureOpsProducer,
+	infrastructureEventsConsumer bus.ClusterAliveConsumer,
+	infrastructureOpsProducer bus.Producer,
+	infrastructureEventsProducer bus.Producer,
+	clock clock.Clock,
 	config config.Config) (*Manager, error) {
+	failureDetector, err := detector.NewDetector(config.Detector, config.PhiThreshold)
+	if err != nil {
+		return nil, err
+	}
+	var store *policy.Store
+	if config.PolicyFile != "" {
+		store, err = policy.LoadStore(config.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = config.ValidThresholdOverrides(store); err != nil {
+			return nil, err
+		}
+	}
+	historyStore, err := history.NewStore(config.HistoryPath)
+	if err != nil {
+		return nil, err
+	}
+	var maintenanceStore maintenance.Store
+	if config.MaintenanceConfigMap != "" {
+		maintenanceStore, err = maintenance.NewConfigMapStore(config.LeaseNamespace, config.MaintenanceConfigMap, clock)
+	} else {
+		maintenanceStore, err = maintenance.NewStore(config.MaintenancePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	webhooks := notification.NewConfig()
+	if config.WebhookFile != "" {
+		webhooks, err = notification.LoadConfig(config.WebhookFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var verifier *authentication.Verifier
+	if config.ClusterKeysFile != "" {
+		keys, err := authentication.LoadKeys(config.ClusterKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier = authentication.NewVerifier(keys, config.HeartbeatMaxAge, config.ClockSkewTolerance, clock)
+	}
+	cache, err := newClusterCache(config.ClusterCacheSize, config.HeartbeatFlushInterval)
+	if err != nil {
+		return nil, err
+	}
+	sequence, err := newHeartbeatSequence(config.ClusterCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	var simulation *dryRun
+	if config.DryRun {
+		simulation = newDryRun(clock.Now())
+	}
+	var breakerStore breaker.Store = breaker.NewMemoryStore()
+	if config.DrainBreakerConfigMap != "" && !config.DryRun {
+		breakerStore, err = breaker.NewConfigMapStore(config.LeaseNamespace, config.DrainBreakerConfigMap)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &Manager{
 		ClustersClient:               *clustersClient,
 		OrganizationsClient:          *organizationsClient,
 		InfrastructureEventsConsumer: infrastructureEventsConsumer,
 		InfrastructureOpsProducer:    infrastructureOpsProducer,
+		InfrastructureEventsProducer: infrastructureEventsProducer,
 		config:                       config,
+		stateMachine:                 statemachine.NewClusterStatusStateMachine(),
+		detector:                     failureDetector,
+		recovery: recovery.NewTracker(recovery.Policy{
+			Name:       config.RecoveryPolicy,
+			Heartbeats: config.RecoveryHeartbeats,
+			Window:     config.RecoveryWindow,
+		}),
+		policies:     policy.NewResolver(store, config.OfflinePolicy, config.Threshold, config.PlatformGracePeriod, config.ThresholdFloor()),
+		clock:        clock,
+		history:      historyStore,
+		expirations:  scheduler.NewScheduler(),
+		maintenance:  maintenanceStore,
+		notifier:     notification.NewNotifier(webhooks, config.WebhookAttempts, config.WebhookBackoff, clock),
+		verifier:     verifier,
+		skews:        skew.NewTracker(config.ClockSkewTolerance),
+		sequence:     sequence,
+		cache:        cache,
+		breaker:      breaker.NewBreaker(config.DrainBreakerCount, config.DrainBreakerPercentage, config.DrainBreakerWindow),
+		breakerStore: breakerStore,
+		drains:       drain.NewQueue(config.MaxConcurrentDrains, config.DrainInterval, config.DrainDuration),
+		elector:      election.NewAlwaysLeader(),
+		forwarder:    newLeaderForwarder(election.NewAlwaysLeader(), config.PeerAddress),
+		dryRun:       simulation,
+		observed:     make(map[string]*grpc_infrastructure_go.ClusterId, 0),
 	}, nil
 }
 
+// settings returns the active configuration.
+func (m *Manager) settings() config.Config {
+	m.configLock.RLock()
+	defer m.configLock.RUnlock()
+	return m.config
+}
+
+// Reload applies the timing and policy settings of a new configuration once it has been validated. The rest of
+// the settings require a restart, and their changes are only logged.
+func (m *Manager) Reload(next config.Config) derrors.Error {
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	// the settings that are not reloaded, such as the flush interval, keep their current values
+	applied := m.settings().WithReloadable(next)
+	var store *policy.Store
+	if next.PolicyFile != "" {
+		var err derrors.Error
+		store, err = policy.LoadStore(next.PolicyFile)
+		if err != nil {
+			return err
+		}
+		if err = applied.ValidThresholdOverrides(store); err != nil {
+			return err
+		}
+	}
+	m.configLock.Lock()
+	defer m.configLock.Unlock()
+	for _, name := range config.RestartRequired(m.config, next) {
+		log.Warn().Str("setting", name).Msg("setting changed, a restart is required to apply it")
+	}
+	m.policies.Update(store, next.OfflinePolicy, next.Threshold, next.PlatformGracePeriod, applied.ThresholdFloor())
+	m.recovery.SetPolicy(recovery.Policy{Name: next.RecoveryPolicy, Heartbeats: next.RecoveryHeartbeats, Window: next.RecoveryWindow})
+	m.skews.SetTolerance(next.ClockSkewTolerance)
+	if m.verifier != nil {
+		m.verifier.SetMaxSkew(next.ClockSkewTolerance)
+	}
+	m.drains.SetLimits(next.MaxConcurrentDrains, next.DrainInterval, next.DrainDuration)
+	m.breaker.SetLimits(next.DrainBreakerCount, next.DrainBreakerPercentage, next.DrainBreakerWindow)
+	m.config = m.config.WithReloadable(next)
+	// the scheduled expirations were computed with the previous thresholds
+	atomic.StoreInt32(&m.resync, 1)
+	log.Info().Msg("configuration reloaded")
+	return nil
+}
+
+// ResyncRequested returns true, only once, if a full resync is required before the next period.
+func (m *Manager) ResyncRequested() bool {
+	return atomic.CompareAndSwapInt32(&m.resync, 1, 0)
+}
+
+// WithElector sets the leader elector of the replica. Only the leader writes to system model and triggers the
+// side effects of the transitions, the requests served from its state are forwarded to it.
+func (m *Manager) WithElector(elector election.Elector) *Manager {
+	m.elector = elector
+	m.forwarder = newLeaderForwarder(elector, m.settings().PeerAddress)
+	return m
+}
+
+// Close stops the webhook notifier and releases the connections to the other replicas and the stores. It must
+// be called once the loops using the manager have finished.
+func (m *Manager) Close() {
+	m.notifier.Stop()
+	if m.forwarder != nil {
+		m.forwarder.close()
+	}
+	if err := m.history.Close(); err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("cannot close the connectivity history")
+	}
+	if err := m.maintenance.Close(); err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("cannot close the maintenance windows")
+	}
+}
+
+// LeadershipGained prepares the replica to apply the transitions. The cached clusters may have been changed
+// by the previous leader, and the drain breaker is restored as it left it.
+func (m *Manager) LeadershipGained() {
+	log.Info().Msg("leadership gained, taking over the transitions of the clusters")
+	m.cache.clear()
+	state, err := m.breakerStore.Load()
+	if err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("unable to load the drain breaker state, starting with a closed breaker")
+		state = &breaker.State{Suppressed: make([]breaker.Suppressed, 0)}
+	}
+	m.breaker.Restore(*state)
+	if state.Open {
+		log.Warn().Str("reason", state.Reason).Int("suppressed", len(state.Suppressed)).Msg("drain breaker restored open")
+		metrics.DrainBreakerOpen.Set(1)
+	} else {
+		metrics.DrainBreakerOpen.Set(0)
+	}
+}
+
+// LeadershipLost stops applying the transitions. The timestamps not yet written are left to the new leader,
+// as writing them now could overwrite newer ones. The expirations and the pending drains are rebuilt by the
+// next full sweep of the leader.
+func (m *Manager) LeadershipLost() {
+	log.Info().Msg("leadership lost, only observing the cluster alive checks")
+	m.cache.clear()
+	m.expirations.Retain(map[string]bool{})
+	metrics.ScheduledExpirations.Set(float64(m.expirations.Len()))
+	m.drains.Clear()
+	m.updateDrainMetrics()
+}
+
+// ClusterAlive processes a cluster alive check. Every replica receives all the checks, but only the leader
+// writes them to system model. The other replicas keep the state derived from the checks up to date to take
+// over the leadership.
 func (m *Manager) ClusterAlive(alive *grpc_connectivity_manager_go.ClusterAlive) derrors.Error {
 	log.Debug().Interface("clusterAlive", alive).Msg("<- incoming cluster alive check")
+	if m.verifier != nil {
+		if reason, vErr := m.verifier.Verify(alive); vErr != nil {
+			log.Warn().Str("organizationID", alive.OrganizationId).Str("clusterID", alive.ClusterId).
+				Int64("timestamp", alive.Timestamp).Str("reason", reason).Msg("cluster alive check rejected")
+			metrics.HeartbeatsRejected.WithLabelValues(reason).Inc()
+			return vErr
+		}
+	}
+	key := clusterKey(alive.OrganizationId, alive.ClusterId)
+	received := m.clock.Now()
+	// the timestamp of the cluster only orders its checks, capped so a clock ahead cannot block the next ones
+	timestamp := alive.Timestamp
+	if timestamp > received.Unix() {
+		timestamp = received.Unix()
+	}
+	if reason := m.sequence.accept(key, timestamp); reason != "" {
+		m.dropClusterAlive(alive, reason)
+		return nil
+	}
+	m.observe(alive.OrganizationId, alive.ClusterId)
 
-	clusterID := &grpc_infrastructure_go.ClusterId{
-		OrganizationId: alive.OrganizationId,
-		ClusterId:      alive.ClusterId,
+	if !m.elector.IsLeader() {
+		m.observeSkew(alive, received)
+		m.detector.Heartbeat(key, received)
+		return nil
 	}
-	getCtx, getCancel := context.WithTimeout(context.Background(), DefaultTimeout)
-	defer getCancel()
-	previous, err := m.ClustersClient.GetCluster(getCtx, clusterID)
-	if err != nil {
-		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get cluster")
-		return conversions.ToDerror(err)
+	previous, cached := m.cache.get(key, received)
+	if !cached {
+		clusterID := &grpc_infrastructure_go.ClusterId{
+			OrganizationId: alive.OrganizationId,
+			ClusterId:      alive.ClusterId,
+		}
+		getCtx, getCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer getCancel()
+		cluster, err := m.ClustersClient.GetCluster(getCtx, clusterID)
+		if err != nil {
+			log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get cluster")
+			return conversions.ToDerror(err)
+		}
+		m.simulate(cluster)
+		m.cache.put(key, cluster, received)
+		previous = cluster
 	}
 
+	m.observeSkew(alive, received)
+	// the checks processed before a restart, by a previous leader or forgotten by the sequence are only known by
+	// system model, a check sent before the reception of the last one stored is stale
+	if reason := dropReason(previous.LastAliveTimestamp, timestamp); reason != "" {
+		m.dropClusterAlive(alive, reason)
+		return nil
+	}
+	// the clock of the cluster only orders its checks and flags its skew, the expirations rely on the reception time
+	lastAlive := received.Unix()
 	updateClusterRequest := &grpc_infrastructure_go.UpdateClusterRequest{
 		OrganizationId:             alive.OrganizationId,
 		ClusterId:                  alive.ClusterId,
 		UpdateLastClusterTimestamp: true,
-		LastClusterTimestamp:       alive.Timestamp,
+		LastClusterTimestamp:       lastAlive,
 	}
 
-	var nextStatus grpc_connectivity_manager_go.ClusterStatus
-	send := false
-	if previous.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_OFFLINE || previous.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_UNKNOWN {
-		nextStatus = grpc_connectivity_manager_go.ClusterStatus_ONLINE
-		send = true
-	} else if previous.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON {
-		nextStatus = grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON
-		send = true
+	transition, tErr := m.stateMachine.Next(previous.ClusterStatus, statemachine.Alive)
+	if tErr != nil {
+		log.Error().Str("trace", tErr.DebugReport()).Msg("unable to process cluster alive check")
+		return tErr
 	}
-
-	if send {
+	if transition.Changed() {
 		updateClusterRequest.UpdateStatus = true
-		updateClusterRequest.Status = nextStatus
+		updateClusterRequest.Status = transition.To
+		// the cluster is back, its drain is no longer pending
+		if _, exists := previous.Labels[drain.StateLabel]; exists {
+			updateClusterRequest.RemoveLabels = true
+			updateClusterRequest.Labels = map[string]string{drain.StateLabel: ""}
+		}
+	}
+
+	// the status changes are written immediately, the timestamps are batched by FlushHeartbeats
+	if transition.Changed() || !m.cache.enabled() {
+		err := m.updateCluster(context.Background(), updateClusterRequest)
+		if err != nil {
+			log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to update cluster")
+			m.cache.remove(key)
+			m.forget(alive.OrganizationId, alive.ClusterId)
+			return conversions.ToDerror(err)
+		}
+		m.cache.update(key, transition.To, lastAlive, true)
+		if updateClusterRequest.RemoveLabels {
+			applyLabels(previous, updateClusterRequest.Labels, true)
+			m.cache.setLabels(key, updateClusterRequest.Labels, true)
+		}
+	} else {
+		m.cache.update(key, transition.To, lastAlive, false)
+		metrics.HeartbeatsCoalesced.Inc()
+	}
+	// the side effects, such as the recovery uncordoning the cluster, start from the status just stored
+	previous.ClusterStatus = transition.To
+	previous.LastAliveTimestamp = lastAlive
+	m.detector.Heartbeat(key, received)
+	metrics.HeartbeatsReceived.WithLabelValues(alive.OrganizationId, alive.ClusterId).Inc()
+	metrics.HeartbeatLag.WithLabelValues(alive.OrganizationId, alive.ClusterId).Set(float64(received.Unix() - alive.Timestamp))
+	m.scheduleExpiration(previous, transition.To, lastAlive)
+	if transition.Changed() {
+		m.onStatusChanged(alive.OrganizationId, alive.ClusterId, transition)
+	}
+	m.executeSideEffects(context.Background(), previous, transition)
+
+	if !transition.Changed() && previous.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON {
+		m.recoveryHeartbeat(context.Background(), previous, received)
+	}
+	// the cluster was uncordoned by an operator
+	if transition.To == grpc_connectivity_manager_go.ClusterStatus_ONLINE && hasCordonLabels(previous) {
+		m.updateLabels(context.Background(), previous, map[string]string{recovery.CordonLabel: "", recovery.SinceLabel: ""}, true)
+	}
+
+	return nil
+}
+
+// startRecovery starts tracking a cluster that comes back after being cordoned offline, unless it was cordoned
+// manually. The start of the recovery is stored in the cluster so a new leader can take it over.
+func (m *Manager) startRecovery(ctx context.Context, cluster *grpc_infrastructure_go.Cluster) {
+	if cluster.Labels[recovery.CordonLabel] != statemachine.GracePeriodExpired.String() {
+		log.Info().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).
+			Msg("cluster not cordoned by the connectivity manager, recovery policy not applied")
+		return
+	}
+	now := m.clock.Now()
+	tracked, uncordon := m.recovery.Start(clusterKey(cluster.OrganizationId, cluster.ClusterId), now)
+	if !tracked {
+		return
+	}
+	if uncordon {
+		log.Info().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Msg("recovery policy satisfied, uncordoning cluster")
+		m.applyTransition(ctx, cluster, statemachine.Uncordon)
+		return
+	}
+	m.updateLabels(ctx, cluster, map[string]string{recovery.SinceLabel: strconv.FormatInt(now.Unix(), 10)}, false)
+}
+
+// recoveryHeartbeat counts a cluster alive check of a cordoned cluster for its recovery, uncordoning it once
+// the recovery policy is satisfied. A recovery started by a previous leader is restored from the cluster.
+func (m *Manager) recoveryHeartbeat(ctx context.Context, cluster *grpc_infrastructure_go.Cluster, received time.Time) {
+	key := clusterKey(cluster.OrganizationId, cluster.ClusterId)
+	if !m.recovery.Recovering(key) {
+		since, err := strconv.ParseInt(cluster.Labels[recovery.SinceLabel], 10, 64)
+		if err != nil {
+			return
+		}
+		m.recovery.Restore(key, time.Unix(since, 0))
+	}
+	uncordon, restarted := m.recovery.Heartbeat(key, received, m.policies.Resolve(cluster).Threshold)
+	if restarted {
+		log.Info().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).
+			Msg("cluster alive checks not consecutive, recovery started again")
+		m.updateLabels(ctx, cluster, map[string]string{recovery.SinceLabel: strconv.FormatInt(received.Unix(), 10)}, false)
+	}
+	if uncordon {
+		log.Info().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Msg("recovery policy satisfied, uncordoning cluster")
+		m.applyTransition(ctx, cluster, statemachine.Uncordon)
+	}
+}
+
+// hasCordonLabels returns true if the cluster has any of the labels of the cordon and its recovery.
+func hasCordonLabels(cluster *grpc_infrastructure_go.Cluster) bool {
+	_, cordoned := cluster.Labels[recovery.CordonLabel]
+	_, recovering := cluster.Labels[recovery.SinceLabel]
+	return cordoned || recovering
+}
+
+// cordonLabels returns the labels changed by a transition to record the origin of a cordon: they are added
+// when the grace period expires and removed when the cluster is uncordoned.
+func cordonLabels(trigger statemachine.Trigger) (map[string]string, bool) {
+	switch trigger {
+	case statemachine.GracePeriodExpired:
+		return map[string]string{recovery.CordonLabel: trigger.String()}, false
+	case statemachine.Uncordon:
+		return map[string]string{recovery.CordonLabel: "", recovery.SinceLabel: ""}, true
+	}
+	return nil, false
+}
+
+// updateLabels adds or removes labels of a cluster in system model, in the cache and in the given cluster.
+func (m *Manager) updateLabels(ctx context.Context, cluster *grpc_infrastructure_go.Cluster, labels map[string]string, remove bool) {
+	request := &grpc_infrastructure_go.UpdateClusterRequest{
+		OrganizationId: cluster.OrganizationId,
+		ClusterId:      cluster.ClusterId,
+		AddLabels:      !remove,
+		RemoveLabels:   remove,
+		Labels:         labels,
+	}
+	if err := m.updateCluster(ctx, request); err != nil {
+		log.Error().Interface("update", request).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to update cluster labels")
+		return
 	}
+	applyLabels(cluster, labels, remove)
+	m.cache.setLabels(clusterKey(cluster.OrganizationId, cluster.ClusterId), labels, remove)
+}
+
+// applyLabels adds or removes labels of a cluster.
+func applyLabels(cluster *grpc_infrastructure_go.Cluster, labels map[string]string, remove bool) {
+	if cluster.Labels == nil {
+		cluster.Labels = make(map[string]string, len(labels))
+	}
+	for name, value := range labels {
+		if remove {
+			delete(cluster.Labels, name)
+		} else {
+			cluster.Labels[name] = value
+		}
+	}
+}
 
-	updateCtx, updateCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+// updateCluster writes a cluster update to system model, or only records it in dry run mode. The write is
+// bounded by DefaultTimeout and by the deadline of the given context.
+func (m *Manager) updateCluster(ctx context.Context, request *grpc_infrastructure_go.UpdateClusterRequest) error {
+	if m.dryRun != nil {
+		m.dryRun.update(request)
+		return nil
+	}
+	updateCtx, updateCancel := context.WithTimeout(ctx, DefaultTimeout)
 	defer updateCancel()
-	_, err = m.ClustersClient.UpdateCluster(updateCtx, updateClusterRequest)
+	_, err := m.ClustersClient.UpdateCluster(updateCtx, request)
+	return err
+}
+
+// simulate applies to a cluster read from system model the changes not written in dry run mode.
+func (m *Manager) simulate(cluster *grpc_infrastructure_go.Cluster) {
+	if m.dryRun != nil {
+		m.dryRun.apply(cluster)
+	}
+}
+
+// GetDryRunSummary retrieves the actions not performed since the start in dry run mode.
+func (m *Manager) GetDryRunSummary() (*grpc_connectivity_manager_go.DryRunSummary, derrors.Error) {
+	if m.dryRun == nil {
+		return nil, derrors.NewFailedPreconditionError("dry run mode is not enabled")
+	}
+	return m.dryRun.summary(), nil
+}
+
+// FlushHeartbeats writes to system model the last alive timestamps kept by the cluster cache.
+func (m *Manager) FlushHeartbeats() {
+	for _, pending := range m.cache.pending() {
+		err := m.updateCluster(context.Background(), &grpc_infrastructure_go.UpdateClusterRequest{
+			OrganizationId:             pending.organizationID,
+			ClusterId:                  pending.clusterID,
+			UpdateLastClusterTimestamp: true,
+			LastClusterTimestamp:       pending.lastAlive,
+		})
+		if err != nil {
+			// kept in the cache to be retried on the next flush, even if the cluster was evicted
+			log.Error().Str("organizationID", pending.organizationID).Str("clusterID", pending.clusterID).
+				Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to flush last alive timestamp")
+			continue
+		}
+		m.cache.written(pending.key, pending.lastAlive)
+	}
+}
+
+// dropClusterAlive discards a stale cluster alive check.
+func (m *Manager) dropClusterAlive(alive *grpc_connectivity_manager_go.ClusterAlive, reason string) {
+	log.Debug().Str("organizationID", alive.OrganizationId).Str("clusterID", alive.ClusterId).
+		Int64("timestamp", alive.Timestamp).Str("reason", reason).Msg("cluster alive check dropped")
+	metrics.HeartbeatsDropped.WithLabelValues(reason).Inc()
+}
+
+// observeSkew records the clock skew of a cluster alive check, logging when the cluster exceeds the tolerance
+// or goes back within it.
+func (m *Manager) observeSkew(alive *grpc_connectivity_manager_go.ClusterAlive, received time.Time) {
+	current, changed := m.skews.Observe(clusterKey(alive.OrganizationId, alive.ClusterId), time.Unix(alive.Timestamp, 0), received)
+	metrics.ClockSkew.WithLabelValues(alive.OrganizationId, alive.ClusterId).Set(current.Offset.Seconds())
+	if !changed {
+		return
+	}
+	if current.Exceeded {
+		log.Warn().Str("organizationID", alive.OrganizationId).Str("clusterID", alive.ClusterId).
+			Dur("skew", current.Offset).Dur("tolerance", m.settings().ClockSkewTolerance).Msg("cluster clock skew beyond tolerance")
+		metrics.ClockSkewedClusters.Inc()
+	} else {
+		log.Info().Str("organizationID", alive.OrganizationId).Str("clusterID", alive.ClusterId).
+			Dur("skew", current.Offset).Msg("cluster clock skew back within tolerance")
+		metrics.ClockSkewedClusters.Dec()
+	}
+}
+
+// observe records a cluster that sent a cluster alive check.
+func (m *Manager) observe(organizationID string, clusterID string) {
+	m.observedLock.Lock()
+	defer m.observedLock.Unlock()
+	key := clusterKey(organizationID, clusterID)
+	if _, exists := m.observed[key]; !exists {
+		m.observed[key] = &grpc_infrastructure_go.ClusterId{OrganizationId: organizationID, ClusterId: clusterID}
+	}
+}
+
+// forget removes the information kept for a cluster that has been removed from the cache.
+func (m *Manager) forget(organizationID string, clusterID string) {
+	key := clusterKey(organizationID, clusterID)
+	m.observedLock.Lock()
+	delete(m.observed, key)
+	m.observedLock.Unlock()
+	m.detector.Forget(key)
+	if last, exists := m.skews.Forget(key); exists && last.Exceeded {
+		metrics.ClockSkewedClusters.Dec()
+	}
+	metrics.HeartbeatsReceived.DeleteLabelValues(organizationID, clusterID)
+	metrics.HeartbeatLag.DeleteLabelValues(organizationID, clusterID)
+	metrics.ClockSkew.DeleteLabelValues(organizationID, clusterID)
+}
+
+// forgetUnlisted forgets the clusters that sent cluster alive checks but were not listed by the last sweep.
+func (m *Manager) forgetUnlisted(seen map[string]bool) {
+	unlisted := make([]*grpc_infrastructure_go.ClusterId, 0)
+	m.observedLock.Lock()
+	for key, clusterID := range m.observed {
+		if !seen[key] {
+			unlisted = append(unlisted, clusterID)
+		}
+	}
+	m.observedLock.Unlock()
+	for _, clusterID := range unlisted {
+		log.Debug().Str("organizationID", clusterID.OrganizationId).Str("clusterID", clusterID.ClusterId).Msg("forgetting cluster no longer listed")
+		m.forget(clusterID.OrganizationId, clusterID.ClusterId)
+	}
+}
+
+// clusterKey returns the key that identifies a cluster in the manager structures.
+func clusterKey(organizationID string, clusterID string) string {
+	return fmt.Sprintf("%s#%s", organizationID, clusterID)
+}
+
+// GetClusterConnectivity retrieves the connectivity information of a given cluster.
+func (m *Manager) GetClusterConnectivity(clusterID *grpc_infrastructure_go.ClusterId) (*grpc_connectivity_manager_go.ClusterConnectivity, derrors.Error) {
+	getCtx, getCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer getCancel()
+	cluster, err := m.ClustersClient.GetCluster(getCtx, clusterID)
 	if err != nil {
-		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to update cluster")
-		return conversions.ToDerror(err)
+		return nil, conversions.ToDerror(err)
 	}
+	return m.toClusterConnectivity(cluster), nil
+}
 
-	return nil
+// ListClusterConnectivity retrieves the connectivity information of all the clusters of an organization.
+func (m *Manager) ListClusterConnectivity(organizationID *grpc_organization_go.OrganizationId) (*grpc_connectivity_manager_go.ClusterConnectivityList, derrors.Error) {
+	listCtx, listCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer listCancel()
+	clusters, err := m.ClustersClient.ListClusters(listCtx, organizationID)
+	if err != nil {
+		return nil, conversions.ToDerror(err)
+	}
+	result := make([]*grpc_connectivity_manager_go.ClusterConnectivity, 0, len(clusters.Clusters))
+	for _, cluster := range clusters.Clusters {
+		result = append(result, m.toClusterConnectivity(cluster))
+	}
+	return &grpc_connectivity_manager_go.ClusterConnectivityList{
+		Clusters: result,
+	}, nil
 }
 
+// toClusterConnectivity transforms a system model cluster into its connectivity information.
+func (m *Manager) toClusterConnectivity(cluster *grpc_infrastructure_go.Cluster) *grpc_connectivity_manager_go.ClusterConnectivity {
+	clockSkew, _ := m.skews.Get(clusterKey(cluster.OrganizationId, cluster.ClusterId))
+	return &grpc_connectivity_manager_go.ClusterConnectivity{
+		OrganizationId:     cluster.OrganizationId,
+		ClusterId:          cluster.ClusterId,
+		ClusterStatus:      cluster.ClusterStatus,
+		LastAliveTimestamp: cluster.LastAliveTimestamp,
+		GracePeriod:        cluster.GracePeriod,
+		InMaintenance:      m.activeMaintenance(cluster.OrganizationId, cluster.ClusterId, m.clock.Now()) != nil,
+		ClockSkewSeconds:   int64(clockSkew.Offset.Seconds()),
+		ClockSkewExceeded:  clockSkew.Exceeded,
+	}
+}
+
+// TransitionClustersToOffline performs a full sweep over the clusters of system model, checking their
+// expiration and scheduling their next check. The organizations are processed by a pool of
+// SweepConcurrency workers, and those not processed within SweepTimeout are skipped until the next sweep.
 func (m *Manager) TransitionClustersToOffline() {
+	start := m.clock.Now()
+	defer func() {
+		metrics.SweepDuration.Observe(m.clock.Now().Sub(start).Seconds())
+	}()
+	sweepCtx, sweepCancel := context.WithTimeout(context.Background(), m.settings().SweepTimeout)
+	defer sweepCancel()
 	// TODO Get only clusters that are online or online_cordon using a specific endpoint
-	orgCtx, orgCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	orgCtx, orgCancel := context.WithTimeout(sweepCtx, DefaultTimeout)
 	defer orgCancel()
 	organizations, err := m.OrganizationsClient.ListOrganizations(orgCtx, &grpc_common_go.Empty{})
 	if err != nil {
 		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get the list of organization, skipping transitioning clusters to offline")
 		return
 	}
+
+	result := newSweepResult()
+	pending := make(chan string, len(organizations.Organizations))
 	for _, org := range organizations.Organizations {
-		log.Debug().Str("organizationID", org.OrganizationId).Msg("checking organization clusters")
-		organizationID := &grpc_organization_go.OrganizationId{
-			OrganizationId: org.OrganizationId,
+		pending <- org.OrganizationId
+	}
+	close(pending)
+	workers := m.settings().SweepConcurrency
+	if workers > len(organizations.Organizations) {
+		workers = len(organizations.Organizations)
+	}
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for organizationID := range pending {
+				m.sweepOrganization(sweepCtx, organizationID, result)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for value, name := range grpc_connectivity_manager_go.ClusterStatus_name {
+		metrics.ClustersByStatus.WithLabelValues(name).Set(float64(result.clustersByStatus[grpc_connectivity_manager_go.ClusterStatus(value)]))
+	}
+	metrics.SweepSkippedOrganizations.Set(float64(len(result.skipped)))
+	if len(result.skipped) > 0 {
+		log.Warn().Strs("organizations", result.skipped).Int("total", len(organizations.Organizations)).Msg("organizations skipped by the sweep")
+	} else {
+		// the deadlines of the clusters not seen can only be removed if all the organizations were listed
+		m.expirations.Retain(result.seen)
+		m.forgetUnlisted(result.seen)
+		m.breaker.SetTotal(len(result.seen))
+	}
+	metrics.ScheduledExpirations.Set(float64(m.expirations.Len()))
+}
+
+// sweepResult gathers the outcome of the organizations processed by the sweep workers.
+type sweepResult struct {
+	sync.Mutex
+	// clustersByStatus with the number of clusters on each status
+	clustersByStatus map[grpc_connectivity_manager_go.ClusterStatus]int
+	// seen with the keys of the clusters listed
+	seen map[string]bool
+	// skipped with the organizations whose clusters could not be listed
+	skipped []string
+}
+
+func newSweepResult() *sweepResult {
+	return &sweepResult{
+		clustersByStatus: make(map[grpc_connectivity_manager_go.ClusterStatus]int, 0),
+		seen:             make(map[string]bool, 0),
+		skipped:          make([]string, 0),
+	}
+}
+
+// sweepOrganization checks the expiration of the clusters of an organization, unless the sweep deadline has
+// been reached.
+func (m *Manager) sweepOrganization(sweepCtx context.Context, organizationID string, result *sweepResult) {
+	if sweepCtx.Err() != nil {
+		result.skip(organizationID)
+		return
+	}
+	log.Debug().Str("organizationID", organizationID).Msg("checking organization clusters")
+	clusterCtx, clusterCancel := context.WithTimeout(sweepCtx, DefaultTimeout)
+	defer clusterCancel()
+	clusters, err := m.ClustersClient.ListClusters(clusterCtx, &grpc_organization_go.OrganizationId{
+		OrganizationId: organizationID,
+	})
+	if err != nil {
+		log.Error().Str("organizationID", organizationID).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get the list of organization clusters, skipping transitioning clusters to offline in that organization")
+		result.skip(organizationID)
+		return
+	}
+	for _, cluster := range clusters.Clusters {
+		m.simulate(cluster)
+		result.add(cluster)
+		m.checkTransitionClusterToOffline(sweepCtx, cluster)
+		m.resumeDrain(cluster)
+	}
+}
+
+// resumeDrain queues again the drain of a cluster that was pending when the previous leader stopped.
+func (m *Manager) resumeDrain(cluster *grpc_infrastructure_go.Cluster) {
+	if cluster.ClusterStatus != grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON || cluster.Labels[drain.StateLabel] != drain.PendingState {
+		return
+	}
+	if m.drains.Enqueue(cluster.OrganizationId, cluster.ClusterId, m.clock.Now()) {
+		log.Info().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).Msg("pending drain queued again")
+		m.updateDrainMetrics()
+	}
+}
+
+func (r *sweepResult) add(cluster *grpc_infrastructure_go.Cluster) {
+	r.Lock()
+	defer r.Unlock()
+	r.clustersByStatus[cluster.ClusterStatus]++
+	r.seen[clusterKey(cluster.OrganizationId, cluster.ClusterId)] = true
+}
+
+func (r *sweepResult) skip(organizationID string) {
+	r.Lock()
+	defer r.Unlock()
+	r.skipped = append(r.skipped, organizationID)
+	metrics.SweepSkips.Inc()
+}
+
+// TransitionExpiredClusters checks the clusters whose scheduled expiration is due. The latest information of
+// each cluster is retrieved from system model, as the deadline may have been computed before a cluster alive
+// check received by another replica.
+func (m *Manager) TransitionExpiredClusters() {
+	now := m.clock.Now()
+	for _, deadline := range m.expirations.Due(now) {
+		getCtx, getCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		cluster, err := m.ClustersClient.GetCluster(getCtx, &grpc_infrastructure_go.ClusterId{
+			OrganizationId: deadline.OrganizationId,
+			ClusterId:      deadline.ClusterId,
+		})
+		getCancel()
+		if err != nil {
+			// retry later, the full resync removes the deadlines of the deleted clusters
+			log.Error().Str("organizationID", deadline.OrganizationId).Str("clusterID", deadline.ClusterId).
+				Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get cluster, rescheduling expiration check")
+			m.expirations.Schedule(deadline.Key, deadline.OrganizationId, deadline.ClusterId, now.Add(m.settings().Threshold))
+			continue
+		}
+		m.simulate(cluster)
+		m.checkTransitionClusterToOffline(context.Background(), cluster)
+	}
+	metrics.ScheduledExpirations.Set(float64(m.expirations.Len()))
+}
+
+// scheduleExpiration sets the next expiration check of a cluster on a given status, or cancels it if that
+// status does not expire.
+func (m *Manager) scheduleExpiration(cluster *grpc_infrastructure_go.Cluster, status grpc_connectivity_manager_go.ClusterStatus, lastAliveTimestamp int64) {
+	key := clusterKey(cluster.OrganizationId, cluster.ClusterId)
+	effective := m.policies.Resolve(cluster)
+	lastAlive := time.Unix(lastAliveTimestamp, 0)
+	var at time.Time
+	switch {
+	case m.stateMachine.Allowed(status, statemachine.ThresholdExpired):
+		at = m.detector.Deadline(key, lastAlive, effective.Threshold)
+	case m.stateMachine.Allowed(status, statemachine.GracePeriodExpired):
+		at = lastAlive.Add(effective.GracePeriod.Truncate(time.Second) + time.Second)
+	default:
+		m.expirations.Cancel(key)
+		return
+	}
+	// avoid checking the same cluster on every tick when the deadline has already passed
+	if earliest := m.clock.Now().Add(scheduler.Resolution); at.Before(earliest) {
+		at = earliest
+	}
+	m.expirations.Schedule(key, cluster.OrganizationId, cluster.ClusterId, at)
+}
+
+func (m *Manager) checkTransitionClusterToOffline(ctx context.Context, cluster *grpc_infrastructure_go.Cluster) {
+	// the cluster alive checks not yet written to system model also count
+	if lastAlive := m.cache.lastAlive(clusterKey(cluster.OrganizationId, cluster.ClusterId)); lastAlive > cluster.LastAliveTimestamp {
+		cluster.LastAliveTimestamp = lastAlive
+	}
+	now := m.clock.Now()
+	effective := m.policies.Resolve(cluster)
+	if window := m.activeMaintenance(cluster.OrganizationId, cluster.ClusterId, now); window != nil {
+		log.Debug().Str("clusterID", cluster.ClusterId).Str("windowID", window.WindowId).Msg("cluster in maintenance, skipping expiration")
+		// check again when the window finishes, or earlier in case it is removed
+		recheck := time.Unix(window.End, 0)
+		if next := now.Add(effective.Threshold); next.Before(recheck) {
+			recheck = next
+		}
+		m.expirations.Schedule(clusterKey(cluster.OrganizationId, cluster.ClusterId), cluster.OrganizationId, cluster.ClusterId, recheck)
+		return
+	}
+	// the clusters were not expected to send checks during the maintenance, the countdown starts at its end
+	if ended := m.lastMaintenanceEnd(cluster.OrganizationId, cluster.ClusterId, now); ended > cluster.LastAliveTimestamp {
+		cluster.LastAliveTimestamp = ended
+	}
+	m.scheduleExpiration(cluster, cluster.ClusterStatus, cluster.LastAliveTimestamp)
+	expired := m.detector.Expired(clusterKey(cluster.OrganizationId, cluster.ClusterId), time.Unix(cluster.LastAliveTimestamp, 0), now, effective.Threshold)
+	if expired && m.stateMachine.Allowed(cluster.ClusterStatus, statemachine.ThresholdExpired) {
+		m.applyTransition(ctx, cluster, statemachine.ThresholdExpired)
+	}
+	if now.Unix()-cluster.LastAliveTimestamp > int64(effective.GracePeriod.Seconds()) && m.stateMachine.Allowed(cluster.ClusterStatus, statemachine.GracePeriodExpired) {
+		m.applyTransition(ctx, cluster, statemachine.GracePeriodExpired)
+	}
+}
+
+// applyTransition fires a trigger on the current status of a cluster, stores the resulting status and
+// executes the side effects of the transition.
+func (m *Manager) applyTransition(ctx context.Context, cluster *grpc_infrastructure_go.Cluster, trigger statemachine.Trigger) {
+	transition, tErr := m.stateMachine.Next(cluster.ClusterStatus, trigger)
+	if tErr != nil {
+		log.Error().Str("clusterID", cluster.ClusterId).Str("trace", tErr.DebugReport()).Msg("unable to transition cluster")
+		return
+	}
+	if transition.Changed() {
+		log.Debug().Str("clusterID", cluster.ClusterId).Str("from", transition.From.String()).
+			Str("to", transition.To.String()).Str("trigger", trigger.String()).Msg("transitioning cluster")
+		updateClusterRequest := &grpc_infrastructure_go.UpdateClusterRequest{
+			OrganizationId: cluster.OrganizationId,
+			ClusterId:      cluster.ClusterId,
+			UpdateStatus:   true,
+			Status:         transition.To,
 		}
-		clusterCtx, clusterCancel := context.WithTimeout(context.Background(), DefaultTimeout)
-		defer clusterCancel()
-		clusters, err := m.ClustersClient.ListClusters(clusterCtx, organizationID)
+		labels, remove := cordonLabels(trigger)
+		if labels != nil {
+			updateClusterRequest.AddLabels = !remove
+			updateClusterRequest.RemoveLabels = remove
+			updateClusterRequest.Labels = labels
+		}
+		err := m.updateCluster(ctx, updateClusterRequest)
 		if err != nil {
-			log.Error().Str("organizationID", org.OrganizationId).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get the list of organization clusters, skipping transitioning clusters to offline in that organization")
-		} else {
-			for _, cluster := range clusters.Clusters {
-				m.checkTransitionClusterToOffline(cluster)
-			}
+			log.Error().Interface("update", updateClusterRequest).Str("trace", conversions.ToDerror(err).DebugReport()).Msgf("unable to transition cluster to %s", transition.To.String())
+			return
 		}
+		// the callbacks and the side effects see the status just stored
+		cluster.ClusterStatus = transition.To
+		m.cache.setStatus(clusterKey(cluster.OrganizationId, cluster.ClusterId), transition.To)
+		if labels != nil {
+			applyLabels(cluster, labels, remove)
+			m.cache.setLabels(clusterKey(cluster.OrganizationId, cluster.ClusterId), labels, remove)
+		}
+		m.scheduleExpiration(cluster, transition.To, cluster.LastAliveTimestamp)
+		m.onStatusChanged(cluster.OrganizationId, cluster.ClusterId, transition)
 	}
+	m.executeSideEffects(ctx, cluster, transition)
 }
 
-func (m *Manager) checkTransitionClusterToOffline(cluster *grpc_infrastructure_go.Cluster) {
-	if time.Now().Unix()-cluster.LastAliveTimestamp > int64(m.config.Threshold.Seconds()) {
-		var nextStatus grpc_connectivity_manager_go.ClusterStatus
-		send := false
-		if cluster.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_ONLINE {
-			nextStatus = grpc_connectivity_manager_go.ClusterStatus_OFFLINE
-			send = true
-		} else if cluster.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON {
-			nextStatus = grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON
-			send = true
+// executeSideEffects runs the actions attached to a transition once it has been applied.
+func (m *Manager) executeSideEffects(ctx context.Context, cluster *grpc_infrastructure_go.Cluster, transition *statemachine.Transition) {
+	for _, effect := range transition.SideEffects {
+		switch effect {
+		case statemachine.ApplyOfflinePolicy:
+			m.triggerOfflinePolicy(ctx, cluster)
+		case statemachine.StartRecovery:
+			m.startRecovery(ctx, cluster)
+		case statemachine.NotifyUncordon:
+			m.sendUncordonRequest(cluster)
+		default:
+			log.Warn().Str("sideEffect", effect.String()).Msg("unknown side effect, skipping")
 		}
+	}
+}
 
-		if send {
-			updateClusterRequest := &grpc_infrastructure_go.UpdateClusterRequest{
-				OrganizationId: cluster.OrganizationId,
-				ClusterId:      cluster.ClusterId,
-				UpdateStatus:   true,
-				Status:         nextStatus,
-			}
-			updateCtx, updateCancel := context.WithTimeout(context.Background(), DefaultTimeout)
-			defer updateCancel()
-			_, err := m.ClustersClient.UpdateCluster(updateCtx, updateClusterRequest)
-			if err != nil {
-				log.Error().Interface("update", updateClusterRequest).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to transition cluster to OFFLINE*")
-			}
+// onStatusChanged is called once a new status has been stored in system model.
+func (m *Manager) onStatusChanged(organizationID string, clusterID string, transition *statemachine.Transition) {
+	metrics.Transitions.WithLabelValues(transition.From.String(), transition.To.String()).Inc()
+	if transition.To != grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON {
+		m.recovery.Stop(clusterKey(organizationID, clusterID))
+	}
+	if transition.To == grpc_connectivity_manager_go.ClusterStatus_ONLINE || transition.To == grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON {
+		if m.drains.Remove(organizationID, clusterID) {
+			log.Info().Str("organizationID", organizationID).Str("clusterID", clusterID).Msg("cluster recovered, pending drain cancelled")
+			m.updateDrainMetrics()
 		}
 	}
-	if cluster.ClusterStatus == grpc_connectivity_manager_go.ClusterStatus_OFFLINE {
-		if time.Now().Unix()-cluster.LastAliveTimestamp > cluster.GracePeriod {
-			log.Debug().Msg("transitioning cluster from offline to offline cordon")
-			updateClusterRequest := &grpc_infrastructure_go.UpdateClusterRequest{
-				OrganizationId: cluster.OrganizationId,
-				ClusterId:      cluster.ClusterId,
-				UpdateStatus:   true,
-				Status:         grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON,
-			}
-			updateCtx, updateCancel := context.WithTimeout(context.Background(), DefaultTimeout)
-			defer updateCancel()
-			_, err := m.ClustersClient.UpdateCluster(updateCtx, updateClusterRequest)
-			if err != nil {
-				log.Error().Interface("update", updateClusterRequest).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to transition cluster to OFFLINE_CORDON")
-			}
-			m.triggerOfflinePolicy(cluster)
+	if transition.Trigger == statemachine.ThresholdExpired && m.breaker.Offline(clusterKey(organizationID, clusterID), m.clock.Now()) {
+		status := m.breaker.Status(m.clock.Now())
+		log.Error().Str("reason", status.Reason).Msg("suspected partition of the management cluster, offline policies suppressed until the drain breaker is released")
+		metrics.DrainBreakerOpen.Set(1)
+		m.saveBreaker()
+	}
+	m.recordHistory(history.Record{
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		Kind:           history.TransitionRecord,
+		From:           transition.From,
+		To:             transition.To,
+		Reason:         transition.Trigger.String(),
+	})
+	m.publishStatusChange(organizationID, clusterID, transition)
+	if m.dryRun != nil {
+		m.dryRun.transition(transition.From, transition.To)
+	}
+	if event, notify := notification.Event(transition.From, transition.To); notify {
+		if m.dryRun != nil {
+			log.Info().Str("organizationID", organizationID).Str("clusterID", clusterID).Str("event", event).Msg("dry run, would notify webhooks")
+			m.dryRun.notification()
+			return
 		}
+		m.notifier.Notify(notification.Notification{
+			Event:          event,
+			OrganizationId: organizationID,
+			ClusterId:      clusterID,
+			OldStatus:      transition.From.String(),
+			NewStatus:      transition.To.String(),
+			Reason:         transition.Trigger.String(),
+			Timestamp:      m.clock.Now().Unix(),
+		})
+	}
+}
+
+// recordHistory appends a record to the connectivity history with the current time.
+func (m *Manager) recordHistory(record history.Record) {
+	record.Timestamp = m.clock.Now().Unix()
+	if err := m.history.Append(record); err != nil {
+		log.Error().Interface("record", record).Str("trace", err.DebugReport()).Msg("unable to record connectivity history")
+	}
+}
+
+// ListClusterHistory retrieves the connectivity history matching a request.
+func (m *Manager) ListClusterHistory(request *grpc_connectivity_manager_go.ClusterHistoryRequest) (*grpc_connectivity_manager_go.ClusterHistory, derrors.Error) {
+	records, err := m.history.Query(history.Filter{
+		OrganizationId: request.OrganizationId,
+		ClusterId:      request.ClusterId,
+		From:           request.FromTimestamp,
+		To:             request.ToTimestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*grpc_connectivity_manager_go.ClusterHistoryRecord, 0, len(records))
+	for _, record := range records {
+		result = append(result, &grpc_connectivity_manager_go.ClusterHistoryRecord{
+			OrganizationId: record.OrganizationId,
+			ClusterId:      record.ClusterId,
+			Timestamp:      record.Timestamp,
+			Kind:           record.Kind,
+			FromStatus:     record.From,
+			ToStatus:       record.To,
+			Reason:         record.Reason,
+		})
+	}
+	return &grpc_connectivity_manager_go.ClusterHistory{Records: result}, nil
+}
+
+// activeMaintenance returns the maintenance window covering a cluster at a given time, or nil if there is none.
+func (m *Manager) activeMaintenance(organizationID string, clusterID string, now time.Time) *maintenance.Window {
+	window, err := maintenance.Active(m.maintenance, organizationID, clusterID, now)
+	if err != nil {
+		log.Error().Str("organizationID", organizationID).Str("clusterID", clusterID).Str("trace", err.DebugReport()).Msg("unable to check maintenance windows")
+		return nil
 	}
+	return window
+}
+
+// lastMaintenanceEnd returns the end of the last finished maintenance window covering a cluster, or zero.
+func (m *Manager) lastMaintenanceEnd(organizationID string, clusterID string, now time.Time) int64 {
+	end, err := maintenance.LastEnded(m.maintenance, organizationID, clusterID, now)
+	if err != nil {
+		log.Error().Str("organizationID", organizationID).Str("clusterID", clusterID).Str("trace", err.DebugReport()).Msg("unable to check maintenance windows")
+		return 0
+	}
+	return end
+}
+
+// AddMaintenanceWindow creates a maintenance window for a cluster or for all the clusters of an organization.
+func (m *Manager) AddMaintenanceWindow(request *grpc_connectivity_manager_go.AddMaintenanceWindowRequest) (*grpc_connectivity_manager_go.MaintenanceWindow, derrors.Error) {
+	if m.dryRun != nil {
+		return nil, derrors.NewFailedPreconditionError(dryRunMaintenance)
+	}
+	if request.EndTimestamp <= request.StartTimestamp {
+		return nil, derrors.NewInvalidArgumentError("maintenance window must end after its start").WithParams(request.StartTimestamp, request.EndTimestamp)
+	}
+	window := maintenance.NewWindow(request.OrganizationId, request.ClusterId, request.StartTimestamp, request.EndTimestamp, request.Reason)
+	if err := m.maintenance.Prune(m.clock.Now().Add(-maintenance.Retention)); err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("unable to prune finished maintenance windows")
+	}
+	if err := m.maintenance.Add(window); err != nil {
+		return nil, err
+	}
+	log.Info().Interface("window", window).Msg("maintenance window added")
+	return toMaintenanceWindow(window), nil
+}
+
+// ListMaintenanceWindows retrieves the maintenance windows of an organization, or those covering a cluster.
+func (m *Manager) ListMaintenanceWindows(request *grpc_connectivity_manager_go.MaintenanceWindowListRequest) (*grpc_connectivity_manager_go.MaintenanceWindowList, derrors.Error) {
+	windows, err := m.maintenance.List(request.OrganizationId, request.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*grpc_connectivity_manager_go.MaintenanceWindow, 0, len(windows))
+	for _, window := range windows {
+		result = append(result, toMaintenanceWindow(window))
+	}
+	return &grpc_connectivity_manager_go.MaintenanceWindowList{
+		Windows: result,
+	}, nil
+}
+
+// RemoveMaintenanceWindow deletes a maintenance window.
+func (m *Manager) RemoveMaintenanceWindow(windowID *grpc_connectivity_manager_go.MaintenanceWindowId) derrors.Error {
+	if m.dryRun != nil {
+		return derrors.NewFailedPreconditionError(dryRunMaintenance)
+	}
+	if err := m.maintenance.Remove(windowID.OrganizationId, windowID.WindowId); err != nil {
+		return err
+	}
+	log.Info().Str("organizationID", windowID.OrganizationId).Str("windowID", windowID.WindowId).Msg("maintenance window removed")
+	return nil
+}
+
+// ListNotificationDeliveries retrieves the last webhook deliveries of an organization.
+func (m *Manager) ListNotificationDeliveries(organizationID *grpc_organization_go.OrganizationId) (*grpc_connectivity_manager_go.NotificationDeliveryList, derrors.Error) {
+	deliveries := m.notifier.Deliveries(organizationID.OrganizationId)
+	result := make([]*grpc_connectivity_manager_go.NotificationDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, &grpc_connectivity_manager_go.NotificationDelivery{
+			DeliveryId:     delivery.DeliveryId,
+			OrganizationId: delivery.Notification.OrganizationId,
+			ClusterId:      delivery.Notification.ClusterId,
+			Event:          delivery.Notification.Event,
+			Url:            delivery.URL,
+			Attempts:       int32(delivery.Attempts),
+			StatusCode:     int32(delivery.StatusCode),
+			Error:          delivery.Error,
+			Delivered:      delivery.Delivered,
+			Timestamp:      delivery.Timestamp,
+		})
+	}
+	return &grpc_connectivity_manager_go.NotificationDeliveryList{
+		Deliveries: result,
+	}, nil
+}
+
+// toMaintenanceWindow transforms a maintenance window into its gRPC representation.
+func toMaintenanceWindow(window maintenance.Window) *grpc_connectivity_manager_go.MaintenanceWindow {
+	return &grpc_connectivity_manager_go.MaintenanceWindow{
+		WindowId:       window.WindowId,
+		OrganizationId: window.OrganizationId,
+		ClusterId:      window.ClusterId,
+		StartTimestamp: window.Start,
+		EndTimestamp:   window.End,
+		Reason:         window.Reason,
+	}
+}
+
+// saveBreaker persists the state of the drain breaker, so the next leader resumes it.
+func (m *Manager) saveBreaker() {
+	if err := m.breakerStore.Save(m.breaker.State()); err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("unable to save the drain breaker state")
+	}
+}
+
+// GetDrainBreaker retrieves the status of the drain breaker.
+func (m *Manager) GetDrainBreaker() (*grpc_connectivity_manager_go.DrainBreaker, derrors.Error) {
+	return toDrainBreaker(m.breaker.Status(m.clock.Now())), nil
+}
+
+// ReleaseDrainBreaker closes the drain breaker so the offline policies are triggered again. The policies
+// suppressed while it was open are only triggered if requested, for the clusters that are still cordoned offline.
+func (m *Manager) ReleaseDrainBreaker(request *grpc_connectivity_manager_go.ReleaseDrainBreakerRequest) derrors.Error {
+	if !m.breaker.Status(m.clock.Now()).Open {
+		return derrors.NewFailedPreconditionError("drain breaker is not open")
+	}
+	suppressed := m.breaker.Release()
+	metrics.DrainBreakerOpen.Set(0)
+	m.saveBreaker()
+	log.Info().Int("suppressed", len(suppressed)).Bool("applySuppressed", request.ApplySuppressed).Msg("drain breaker released")
+	if !request.ApplySuppressed {
+		return nil
+	}
+	for _, entry := range suppressed {
+		getCtx, getCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		cluster, err := m.ClustersClient.GetCluster(getCtx, &grpc_infrastructure_go.ClusterId{
+			OrganizationId: entry.OrganizationId,
+			ClusterId:      entry.ClusterId,
+		})
+		getCancel()
+		if err != nil {
+			log.Error().Str("organizationID", entry.OrganizationId).Str("clusterID", entry.ClusterId).
+				Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to get cluster, suppressed offline policy not triggered")
+			continue
+		}
+		m.simulate(cluster)
+		if cluster.ClusterStatus != grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON {
+			log.Debug().Str("organizationID", entry.OrganizationId).Str("clusterID", entry.ClusterId).
+				Str("status", cluster.ClusterStatus.String()).Msg("cluster no longer cordoned offline, suppressed offline policy not triggered")
+			continue
+		}
+		m.triggerOfflinePolicy(context.Background(), cluster)
+	}
+	return nil
+}
+
+// ListPendingDrains retrieves the drains of an organization waiting in the drain queue and those in flight.
+func (m *Manager) ListPendingDrains(organizationID *grpc_organization_go.OrganizationId) (*grpc_connectivity_manager_go.PendingDrainList, derrors.Error) {
+	pending := m.drains.Pending(organizationID.OrganizationId)
+	inFlight := m.drains.InFlight(organizationID.OrganizationId, m.clock.Now())
+	result := &grpc_connectivity_manager_go.PendingDrainList{
+		Pending:  make([]*grpc_connectivity_manager_go.PendingDrain, 0, len(pending)),
+		InFlight: make([]*grpc_connectivity_manager_go.PendingDrain, 0, len(inFlight)),
+	}
+	for _, queued := range pending {
+		result.Pending = append(result.Pending, toPendingDrain(queued))
+	}
+	for _, sent := range inFlight {
+		result.InFlight = append(result.InFlight, toPendingDrain(sent))
+	}
+	return result, nil
+}
+
+func toPendingDrain(queued drain.Drain) *grpc_connectivity_manager_go.PendingDrain {
+	result := &grpc_connectivity_manager_go.PendingDrain{
+		OrganizationId:    queued.OrganizationId,
+		ClusterId:         queued.ClusterId,
+		EnqueuedTimestamp: queued.Enqueued.Unix(),
+	}
+	if !queued.Sent.IsZero() {
+		result.SentTimestamp = queued.Sent.Unix()
+	}
+	return result
+}
+
+func toDrainBreaker(status breaker.Status) *grpc_connectivity_manager_go.DrainBreaker {
+	result := &grpc_connectivity_manager_go.DrainBreaker{
+		Open:            status.Open,
+		Reason:          status.Reason,
+		OfflineClusters: int32(status.Offline),
+		TotalClusters:   int32(status.Total),
+		Suppressed:      make([]*grpc_connectivity_manager_go.SuppressedPolicy, 0, len(status.Suppressed)),
+	}
+	if status.Open {
+		result.OpenedTimestamp = status.Since.Unix()
+	}
+	for _, suppressed := range status.Suppressed {
+		result.Suppressed = append(result.Suppressed, &grpc_connectivity_manager_go.SuppressedPolicy{
+			OrganizationId: suppressed.OrganizationId,
+			ClusterId:      suppressed.ClusterId,
+			Timestamp:      suppressed.Timestamp.Unix(),
+		})
+	}
+	return result
+}
+
+// GetConnectivityReport computes the availability of the clusters of an organization over a period using
+// the connectivity history and the current status of the clusters.
+func (m *Manager) GetConnectivityReport(request *grpc_connectivity_manager_go.ConnectivityReportRequest) (*grpc_connectivity_manager_go.ConnectivityReport, derrors.Error) {
+	to := request.ToTimestamp
+	if to == 0 {
+		to = m.clock.Now().Unix()
+	}
+	var clusters []*grpc_infrastructure_go.Cluster
+	if request.ClusterId != "" {
+		getCtx, getCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer getCancel()
+		cluster, err := m.ClustersClient.GetCluster(getCtx, &grpc_infrastructure_go.ClusterId{
+			OrganizationId: request.OrganizationId,
+			ClusterId:      request.ClusterId,
+		})
+		if err != nil {
+			return nil, conversions.ToDerror(err)
+		}
+		clusters = []*grpc_infrastructure_go.Cluster{cluster}
+	} else {
+		listCtx, listCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer listCancel()
+		list, err := m.ClustersClient.ListClusters(listCtx, &grpc_organization_go.OrganizationId{OrganizationId: request.OrganizationId})
+		if err != nil {
+			return nil, conversions.ToDerror(err)
+		}
+		clusters = list.Clusters
+	}
+	current := make(map[string]grpc_connectivity_manager_go.ClusterStatus, len(clusters))
+	for _, cluster := range clusters {
+		current[cluster.ClusterId] = cluster.ClusterStatus
+	}
+	// The records before the period are required to know the initial status of each cluster
+	records, err := m.history.Query(history.Filter{
+		OrganizationId: request.OrganizationId,
+		ClusterId:      request.ClusterId,
+		To:             to,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report.Compute(request.OrganizationId, records, current, request.FromTimestamp, to).ToGRPC(), nil
+}
+
+// publishStatusChange announces a cluster status change on the infrastructure events queue.
+func (m *Manager) publishStatusChange(organizationID string, clusterID string, transition *statemachine.Transition) {
+	statusChanged := &grpc_connectivity_manager_go.ClusterStatusChanged{
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		OldStatus:      transition.From,
+		NewStatus:      transition.To,
+		Reason:         transition.Trigger.String(),
+		Timestamp:      m.clock.Now().Unix(),
+	}
+	if m.dryRun != nil {
+		log.Debug().Interface("statusChanged", statusChanged).Msg("dry run, would send cluster status changed event")
+		m.dryRun.event()
+		return
+	}
+	sendCtx, sendCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer sendCancel()
+	err := m.InfrastructureEventsProducer.Send(sendCtx, statusChanged)
+	if err != nil {
+		log.Error().Interface("statusChanged", statusChanged).Str("trace", err.DebugReport()).Msg("unable to send cluster status changed event")
+		return
+	}
+	log.Debug().Interface("statusChanged", statusChanged).Msg("cluster status changed event sent to the bus")
 }
 
 // Checks if an OfflinePolicy is set and acts accordingly
-func (m *Manager) triggerOfflinePolicy(cluster *grpc_infrastructure_go.Cluster) {
+func (m *Manager) triggerOfflinePolicy(ctx context.Context, cluster *grpc_infrastructure_go.Cluster) {
 	log.Debug().Interface("cluster", cluster).Msg("triggering offline policy")
-	switch m.config.OfflinePolicy {
+	if window := m.activeMaintenance(cluster.OrganizationId, cluster.ClusterId, m.clock.Now()); window != nil {
+		log.Info().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).
+			Str("windowID", window.WindowId).Msg("cluster in maintenance, offline policy not triggered")
+		m.recordHistory(history.Record{
+			OrganizationId: cluster.OrganizationId,
+			ClusterId:      cluster.ClusterId,
+			Kind:           history.PolicyRecord,
+			From:           cluster.ClusterStatus,
+			To:             cluster.ClusterStatus,
+			Reason:         MaintenanceReason,
+		})
+		return
+	}
+	if !m.breaker.Allow(cluster.OrganizationId, cluster.ClusterId, m.clock.Now()) {
+		log.Warn().Str("organizationID", cluster.OrganizationId).Str("clusterID", cluster.ClusterId).
+			Msg("drain breaker open, offline policy suppressed")
+		metrics.SuppressedPolicies.Inc()
+		m.saveBreaker()
+		m.recordHistory(history.Record{
+			OrganizationId: cluster.OrganizationId,
+			ClusterId:      cluster.ClusterId,
+			Kind:           history.PolicyRecord,
+			From:           cluster.ClusterStatus,
+			To:             cluster.ClusterStatus,
+			Reason:         SuspectedPartitionReason,
+		})
+		return
+	}
+	offlinePolicy := m.policies.Resolve(cluster).OfflinePolicy
+	m.recordHistory(history.Record{
+		OrganizationId: cluster.OrganizationId,
+		ClusterId:      cluster.ClusterId,
+		Kind:           history.PolicyRecord,
+		From:           cluster.ClusterStatus,
+		To:             cluster.ClusterStatus,
+		Reason:         offlinePolicy.String(),
+	})
+	switch offlinePolicy {
 	case grpc_connectivity_manager_go.OfflinePolicy_NONE:
-		log.Debug().Str("offline policy", m.config.OfflinePolicy.String()).Msg("offline policy set to none, no additional steps required")
+		log.Debug().Str("offline policy", offlinePolicy.String()).Msg("offline policy set to none, no additional steps required")
 	case grpc_connectivity_manager_go.OfflinePolicy_DRAIN:
-		m.triggerDrainOfflinePolicy(cluster)
+		m.triggerDrainOfflinePolicy(ctx, cluster)
 	default:
 		log.Debug().Msg("offline policy not set, doing nothing")
 	}
 }
 
-// Triggers a drain offline policy and drains the cluster passed as parameter
-func (m *Manager) triggerDrainOfflinePolicy(cluster *grpc_infrastructure_go.Cluster) {
+// Triggers a drain offline policy, queueing the drain of the cluster passed as parameter. The cluster is labeled
+// so the drain is queued again by a new leader until it is sent.
+func (m *Manager) triggerDrainOfflinePolicy(ctx context.Context, cluster *grpc_infrastructure_go.Cluster) {
+	if !m.drains.Enqueue(cluster.OrganizationId, cluster.ClusterId, m.clock.Now()) {
+		log.Debug().Str("cluster id", cluster.ClusterId).Str("organization id", cluster.OrganizationId).Msg("cluster drain already queued")
+		return
+	}
+	m.updateLabels(ctx, cluster, map[string]string{drain.StateLabel: drain.PendingState}, false)
+	log.Debug().Str("cluster id", cluster.ClusterId).Str("organization id", cluster.OrganizationId).Msg("cluster drain queued")
+	m.DispatchDrains()
+}
+
+// DispatchDrains sends the queued drains allowed by the limits of the drain queue.
+func (m *Manager) DispatchDrains() {
+	defer m.updateDrainMetrics()
+	for {
+		next, ok := m.drains.Next(m.clock.Now())
+		if !ok {
+			return
+		}
+		if !m.breaker.Allow(next.OrganizationId, next.ClusterId, m.clock.Now()) {
+			log.Warn().Str("organizationID", next.OrganizationId).Str("clusterID", next.ClusterId).
+				Msg("drain breaker open, queued drain suppressed")
+			metrics.SuppressedPolicies.Inc()
+			m.saveBreaker()
+			m.drains.Release(next.OrganizationId, next.ClusterId)
+			// the suppressed policy is kept by the drain breaker
+			m.setDrainState(next, "")
+			continue
+		}
+		if !m.sendDrainRequest(next.OrganizationId, next.ClusterId) {
+			retry := m.drains.Retry(next.OrganizationId, next.ClusterId, m.clock.Now())
+			log.Warn().Str("organizationID", next.OrganizationId).Str("clusterID", next.ClusterId).
+				Time("retry", retry).Msg("drain not sent, retrying later")
+			continue
+		}
+		m.setDrainState(next, drain.SentState)
+	}
+}
+
+// setDrainState updates the drain state label of a cluster, removing it if empty.
+func (m *Manager) setDrainState(queued drain.Drain, state string) {
+	cluster := &grpc_infrastructure_go.Cluster{OrganizationId: queued.OrganizationId, ClusterId: queued.ClusterId}
+	m.updateLabels(context.Background(), cluster, map[string]string{drain.StateLabel: state}, state == "")
+}
+
+func (m *Manager) updateDrainMetrics() {
+	pending, inFlight := m.drains.Len()
+	metrics.PendingDrains.Set(float64(pending))
+	metrics.InFlightDrains.Set(float64(inFlight))
+}
+
+// Sends the drain request of a cluster to the bus, returns false if it could not be sent
+func (m *Manager) sendDrainRequest(organizationID string, clusterID string) bool {
 	drainClusterRequest := &grpc_conductor_go.DrainClusterRequest{
 		ClusterId: &grpc_infrastructure_go.ClusterId{
-			OrganizationId: cluster.OrganizationId,
-			ClusterId:      cluster.ClusterId,
+			OrganizationId: organizationID,
+			ClusterId:      clusterID,
 		},
 		ClusterOffline: true,
 	}
+	if m.dryRun != nil {
+		log.Info().Str("cluster id", clusterID).Str("organization id", organizationID).Msg("dry run, would drain cluster")
+		m.dryRun.drain()
+		return true
+	}
 	drainCtx, drainCancel := context.WithTimeout(context.Background(), DefaultTimeout)
 	defer drainCancel()
 	drainErr := m.InfrastructureOpsProducer.Send(drainCtx, drainClusterRequest)
 	if drainErr != nil {
 		log.Error().Interface("send drain cluster request", drainClusterRequest).Str("trace", drainErr.Error()).Msg("unable to send drain cluster request")
+		metrics.DrainRequests.WithLabelValues(metrics.DrainFailed).Inc()
+		return false
+	}
+	metrics.DrainRequests.WithLabelValues(metrics.DrainSent).Inc()
+	log.Debug().Str("cluster id", clusterID).Str("organization id", organizationID).Msg("drain cluster request sent to the bus")
+	return true
+}
+
+// Sends the uncordon request of a recovered cluster to the bus
+func (m *Manager) sendUncordonRequest(cluster *grpc_infrastructure_go.Cluster) {
+	uncordonClusterRequest := &grpc_conductor_go.UncordonClusterRequest{
+		ClusterId: &grpc_infrastructure_go.ClusterId{
+			OrganizationId: cluster.OrganizationId,
+			ClusterId:      cluster.ClusterId,
+		},
+	}
+	if m.dryRun != nil {
+		log.Info().Str("cluster id", cluster.ClusterId).Str("organization id", cluster.OrganizationId).Msg("dry run, would uncordon cluster")
+		m.dryRun.uncordon()
+		return
+	}
+	uncordonCtx, uncordonCancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer uncordonCancel()
+	err := m.InfrastructureOpsProducer.Send(uncordonCtx, uncordonClusterRequest)
+	if err != nil {
+		log.Error().Interface("send uncordon cluster request", uncordonClusterRequest).Str("trace", err.DebugReport()).Msg("unable to send uncordon cluster request")
+		return
 	}
-	log.Debug().Str("cluster id", cluster.ClusterId).Str("organization id", cluster.OrganizationId).Msg("drain cluster request sent to the bus")
+	log.Debug().Str("cluster id", cluster.ClusterId).Str("organization id", cluster.OrganizationId).Msg("uncordon cluster request sent to the bus")
 }
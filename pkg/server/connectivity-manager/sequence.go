@@ -0,0 +1,65 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectivity_manager
+
+import (
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/nalej/derrors"
+	"sync"
+)
+
+// StaleHeartbeat is the reason to drop a check older than the latest one processed.
+const StaleHeartbeat = "stale"
+
+// heartbeatSequence keeps the timestamp of the latest cluster alive check processed for each cluster, to
+// drop the checks received out of order without querying system model. The timestamps
+// of the least recently seen clusters are forgotten beyond the size of the sequence.
+type heartbeatSequence struct {
+	sync.Mutex
+	latest *simplelru.LRU
+}
+
+func newHeartbeatSequence(size int) (*heartbeatSequence, derrors.Error) {
+	latest, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create heartbeat sequence")
+	}
+	return &heartbeatSequence{latest: latest}, nil
+}
+
+// accept records the timestamp of a check unless it is older than the latest one processed, in which case it
+// returns the reason to drop the check.
+func (s *heartbeatSequence) accept(key string, timestamp int64) string {
+	s.Lock()
+	defer s.Unlock()
+	if latest, exists := s.latest.Get(key); exists {
+		if reason := dropReason(latest.(int64), timestamp); reason != "" {
+			return reason
+		}
+	}
+	s.latest.Add(key, timestamp)
+	return ""
+}
+
+// dropReason compares the timestamp of a check with the latest one. The timestamps have a resolution of a
+// second, so the checks sent within the same second as the latest one are accepted.
+func dropReason(latest int64, timestamp int64) string {
+	if timestamp < latest {
+		return StaleHeartbeat
+	}
+	return ""
+}
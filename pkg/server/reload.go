@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/server/config"
+	connectivity_manager "github.com/nalej/connectivity-manager/pkg/server/connectivity-manager"
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ConfigPollPeriod is the period at which the configuration file is checked for changes.
+const ConfigPollPeriod = 10 * time.Second
+
+// Reloader builds the configuration again from all its sources, returning the settings that cannot be read.
+type Reloader func() (*config.Config, []derrors.Error)
+
+// WithReloader sets the configuration file to be watched for changes, and the function that builds the
+// configuration again when it changes or on SIGHUP.
+func (s *Service) WithReloader(path string, reloader Reloader) *Service {
+	s.configPath = path
+	s.reloader = reloader
+	return s
+}
+
+// watchConfig reloads the configuration when the configuration file changes or a SIGHUP is received, until the
+// context is cancelled.
+func (s *Service) watchConfig(ctx context.Context, manager *connectivity_manager.Manager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	ticker := s.clock.NewTicker(ConfigPollPeriod)
+	defer ticker.Stop()
+	last := fileVersion(s.configPath)
+	for {
+		select {
+		case <-signals:
+			log.Info().Msg("SIGHUP received, reloading the configuration")
+		case <-ticker.C():
+			current := fileVersion(s.configPath)
+			if current == "" || current == last {
+				continue
+			}
+			log.Info().Str("path", s.configPath).Msg("configuration file changed, reloading the configuration")
+		case <-ctx.Done():
+			return
+		}
+		last = fileVersion(s.configPath)
+		s.reloadConfig(manager)
+	}
+}
+
+// reloadConfig builds the configuration again and applies it, the active one is kept if it is not valid.
+func (s *Service) reloadConfig(manager *connectivity_manager.Manager) {
+	next, problems := s.reloader()
+	problems = append(problems, next.Problems()...)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			log.Error().Str("trace", problem.DebugReport()).Msg(problem.Error())
+		}
+		log.Error().Int("problems", len(problems)).Msg("invalid configuration, keeping the active one")
+		return
+	}
+	if err := manager.Reload(*next); err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("invalid configuration, keeping the active one")
+		return
+	}
+	next.Print()
+}
+
+// fileVersion identifies the content of a file by its modification time and size, empty if it cannot be read.
+func fileVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Warn().Str("path", path).Err(err).Msg("unable to check the configuration file")
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
@@ -17,25 +17,42 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/bus"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/metrics"
 	"github.com/nalej/connectivity-manager/pkg/queue"
 	"github.com/nalej/connectivity-manager/pkg/server/config"
 	connectivity_manager "github.com/nalej/connectivity-manager/pkg/server/connectivity-manager"
 	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
 	grpc_infrastructure_go "github.com/nalej/grpc-infrastructure-go"
 	grpc_organization_go "github.com/nalej/grpc-organization-go"
 	pulsar_comcast "github.com/nalej/nalej-bus/pkg/bus/pulsar-comcast"
 	"github.com/nalej/nalej-bus/pkg/queue/infrastructure/events"
 	infra_ops "github.com/nalej/nalej-bus/pkg/queue/infrastructure/ops"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
 const (
 	InfrastructureEventsConsumerName = "ConnectivityManager-infra_events"
 	InfrastructureOpsProducerName    = "ConnectivityManager-infra_ops"
+	InfrastructureEventsProducerName = "ConnectivityManager-infra_events_producer"
+	// DryRunConsumerSuffix is appended to the consumer name in dry run mode, so the dry run does not take the
+	// subscription of the replica with the same identity.
+	DryRunConsumerSuffix = "-dry_run"
+	// MetricsShutdownTimeout with the time given to the metrics requests in progress when the service stops.
+	MetricsShutdownTimeout = 5 * time.Second
 )
 
 type Service struct {
@@ -43,13 +60,40 @@ type Service struct {
 	server *grpc.Server
 	// Configuration object
 	configuration *config.Config
+	// Bus clients, created from the configuration if not set
+	busClients *BusClients
+	// Clock for all the timing decisions
+	clock clock.Clock
+	// Identity of the replica, used for the leader election and the subscription to the cluster alive checks
+	identity string
+	// Configuration file watched for changes, not reloaded if empty
+	configPath string
+	// Reloader builds the configuration again on a reload
+	reloader Reloader
+	// Metrics server serving the Prometheus metrics
+	metricsServer *http.Server
+	// Context of the background loops, cancelled when the service stops
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewService(config *config.Config) (*Service, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot obtain the identity of the replica")
+	}
 	server := grpc.NewServer()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	ctx, cancel := context.WithCancel(context.Background())
 	instance := Service{
 		server:        server,
 		configuration: config,
+		clock:         clock.New(),
+		identity:      identity,
+		metricsServer: &http.Server{Addr: fmt.Sprintf(":%d", config.MetricsPort), Handler: mux},
+		ctx:           ctx,
+		cancel:        cancel,
 	}
 
 	return &instance, nil
@@ -61,13 +105,28 @@ type Clients struct {
 }
 
 type BusClients struct {
-	InfrastructureEventsConsumer *events.InfrastructureEventsConsumer
-	InfrastructureOpsProducer    *infra_ops.InfrastructureOpsProducer
+	InfrastructureEventsConsumer bus.ClusterAliveConsumer
+	InfrastructureOpsProducer    bus.Producer
+	InfrastructureEventsProducer bus.Producer
+}
+
+// WithBusClients sets the bus clients to be used instead of connecting to the queue address. It is
+// intended to run the service with an in-memory bus.
+func (s *Service) WithBusClients(busClients *BusClients) *Service {
+	s.busClients = busClients
+	return s
+}
+
+// WithClock sets the clock used for all the timing decisions. It is intended to run the service with a
+// fake clock.
+func (s *Service) WithClock(clock clock.Clock) *Service {
+	s.clock = clock
+	return s
 }
 
 // GetClients creates the required connections with the remote clients.
 func (s *Service) GetClients() (*Clients, derrors.Error) {
-	smConn, err := grpc.Dial(s.configuration.SystemModelAddress, grpc.WithInsecure())
+	smConn, err := grpc.Dial(s.configuration.SystemModelAddress, grpc.WithInsecure(), grpc.WithUnaryInterceptor(metrics.NewSystemModelInterceptor(s.clock)))
 	if err != nil {
 		return nil, derrors.AsError(err, "cannot create connection with the system model component")
 	}
@@ -78,6 +137,15 @@ func (s *Service) GetClients() (*Clients, derrors.Error) {
 	return &Clients{ClusterClient: clClient, OrgClient: orgClient}, nil
 }
 
+// GetElector creates the leader elector for the configured backend.
+func (s *Service) GetElector() (election.Elector, derrors.Error) {
+	// a dry run must never take the leadership from the replicas applying the changes
+	if s.configuration.DryRun || strings.ToLower(s.configuration.LeaderElection) != election.Kubernetes {
+		return election.NewAlwaysLeader(), nil
+	}
+	return election.NewKubernetesElector(s.identity, s.configuration.LeaseNamespace, s.configuration.LeaseName, s.configuration.LeaseDuration)
+}
+
 // GetBusClients creates the required connections with the bus
 func (s *Service) GetBusClients() (*BusClients, derrors.Error) {
 	queueClient := pulsar_comcast.NewClient(s.configuration.QueueAddress, nil)
@@ -89,7 +157,13 @@ func (s *Service) GetBusClients() (*BusClients, derrors.Error) {
 		ClusterAliveRequest:     true,
 	}
 	infrastructureEventConsumerConfig := events.NewConfigInfrastructureEventsConsumer(5, InfrastructureEventsConsumerStruct)
-	infraEventsConsumer, err := events.NewInfrastructureEventsConsumer(queueClient, InfrastructureEventsConsumerName, true, infrastructureEventConsumerConfig)
+	consumerName := fmt.Sprintf("%s-%s", InfrastructureEventsConsumerName, s.identity)
+	if s.configuration.DryRun {
+		consumerName = consumerName + DryRunConsumerSuffix
+	}
+	// Each replica has its own exclusive subscription so all of them receive every cluster alive check, the
+	// identities must be stable to avoid leaving subscriptions behind
+	infraEventsConsumer, err := events.NewInfrastructureEventsConsumer(queueClient, consumerName, true, infrastructureEventConsumerConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -99,16 +173,32 @@ func (s *Service) GetBusClients() (*BusClients, derrors.Error) {
 		return nil, err
 	}
 
+	infraEventsProducer, err := events.NewInfrastructureEventsProducer(queueClient, InfrastructureEventsProducerName)
+	if err != nil {
+		return nil, err
+	}
+
 	return &BusClients{
-		InfrastructureEventsConsumer: infraEventsConsumer,
+		InfrastructureEventsConsumer: bus.NewInfrastructureEventsConsumer(infraEventsConsumer),
 		InfrastructureOpsProducer:    infraOpsProducer,
+		InfrastructureEventsProducer: infraEventsProducer,
 	}, nil
 }
 
+// LaunchMetrics serves the Prometheus metrics over HTTP.
+func (s *Service) LaunchMetrics() {
+	log.Info().Uint32("port", s.configuration.MetricsPort).Msg("Launching HTTP metrics server")
+	if err := s.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal().Errs("failed to serve metrics: %v", []error{err})
+	}
+}
+
 func (s *Service) Run() {
-	vErr := s.configuration.Validate()
-	if vErr != nil {
-		log.Fatal().Str("err", vErr.DebugReport()).Msg("invalid configuration")
+	if problems := s.configuration.Problems(); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Error().Str("trace", problem.DebugReport()).Msg(problem.Error())
+		}
+		log.Fatal().Int("problems", len(problems)).Msg("invalid configuration")
 	}
 	s.configuration.Print()
 
@@ -122,9 +212,13 @@ func (s *Service) Run() {
 		log.Fatal().Str("err", cErr.DebugReport()).Msg("Cannot create clients")
 	}
 
-	busClients, bErr := s.GetBusClients()
-	if bErr != nil {
-		log.Fatal().Str("err", bErr.DebugReport()).Msg("Cannot create bus clients")
+	busClients := s.busClients
+	if busClients == nil {
+		var bErr derrors.Error
+		busClients, bErr = s.GetBusClients()
+		if bErr != nil {
+			log.Fatal().Str("err", bErr.DebugReport()).Msg("Cannot create bus clients")
+		}
 	}
 
 	connectivityManagerManager, nmErr := connectivity_manager.NewManager(
@@ -132,13 +226,30 @@ func (s *Service) Run() {
 		&clients.OrgClient,
 		busClients.InfrastructureEventsConsumer,
 		busClients.InfrastructureOpsProducer,
+		busClients.InfrastructureEventsProducer,
+		s.clock,
 		*s.configuration)
 	if nmErr != nil {
 		log.Fatal().Str("err", nmErr.Error()).Msg("Cannot create connectivity-manager manager")
 	}
 
-	infraEventsHandler := queue.NewInfrastructureEventsHandler(connectivityManagerManager, busClients.InfrastructureEventsConsumer)
-	infraEventsHandler.Run(s.configuration.Threshold)
+	elector, eErr := s.GetElector()
+	if eErr != nil {
+		log.Fatal().Str("err", eErr.DebugReport()).Msg("Cannot create leader elector")
+	}
+	go elector.Run(s.ctx)
+	connectivityManagerManager.WithElector(elector)
+
+	infraEventsHandler := queue.NewInfrastructureEventsHandler(connectivityManagerManager, busClients.InfrastructureEventsConsumer, elector, s.clock)
+	infraEventsHandler.Run(s.ctx, s.configuration.ResyncInterval, s.configuration.HeartbeatFlushInterval)
+	if s.reloader != nil {
+		go s.watchConfig(s.ctx, connectivityManagerManager)
+	}
+
+	connectivityManagerHandler := connectivity_manager.NewHandler(connectivityManagerManager)
+	grpc_connectivity_manager_go.RegisterConnectivityManagerServer(s.server, connectivityManagerHandler)
+
+	go s.LaunchMetrics()
 
 	// Register reflection service on gRPC server
 	if s.configuration.Debug {
@@ -151,4 +262,18 @@ func (s *Service) Run() {
 		log.Fatal().Errs("failed to serve: %v", []error{err})
 	}
 
+	// stopped, wait for the loops before releasing what they use
+	infraEventsHandler.Wait()
+	connectivityManagerManager.Close()
+}
+
+// Stop the background loops, the metrics server and the gRPC server. Run returns once the loops have finished.
+func (s *Service) Stop() {
+	s.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), MetricsShutdownTimeout)
+	defer cancel()
+	if err := s.metricsServer.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("cannot shut down the metrics server")
+	}
+	s.server.GracefulStop()
 }
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server_test
+
+import (
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/drain"
+	"github.com/nalej/connectivity-manager/pkg/server/config"
+	"github.com/nalej/connectivity-manager/pkg/testhelpers"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	grpc_infrastructure_go "github.com/nalej/grpc-infrastructure-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"net"
+	"time"
+)
+
+const (
+	organizationID = "org"
+	clusterID      = "cluster"
+	threshold      = 30 * time.Second
+	gracePeriod    = 60 * time.Second
+	waitTimeout    = 5 * time.Second
+)
+
+var _ = ginkgo.Describe("Service", func() {
+
+	var env *testhelpers.Environment
+
+	// launch starts the environment with a single online cluster that has just sent a cluster alive check.
+	launch := func(offlinePolicy grpc_connectivity_manager_go.OfflinePolicy) {
+		var err error
+		env, err = testhelpers.NewEnvironment(config.Config{
+			Threshold:           threshold,
+			PlatformGracePeriod: 2 * gracePeriod,
+			OfflinePolicy:       offlinePolicy,
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		env.SystemModel.AddCluster(&grpc_infrastructure_go.Cluster{
+			OrganizationId:     organizationID,
+			ClusterId:          clusterID,
+			ClusterStatus:      grpc_connectivity_manager_go.ClusterStatus_ONLINE,
+			LastAliveTimestamp: env.Clock.Now().Unix(),
+			GracePeriod:        int64(gracePeriod.Seconds()),
+		})
+		// the first check takes the leadership and sweeps the clusters
+		env.Advance(time.Second)
+	}
+
+	lastAlive := func() int64 {
+		cluster, err := env.SystemModel.Cluster(organizationID, clusterID)
+		gomega.Expect(err).To(gomega.Succeed())
+		return cluster.LastAliveTimestamp
+	}
+
+	drainLabel := func() string {
+		cluster, err := env.SystemModel.Cluster(organizationID, clusterID)
+		gomega.Expect(err).To(gomega.Succeed())
+		return cluster.Labels[drain.StateLabel]
+	}
+
+	ginkgo.AfterEach(func() {
+		if env != nil {
+			env.Stop()
+			env = nil
+		}
+	})
+
+	ginkgo.It("should keep online a cluster sending its cluster alive checks", func() {
+		launch(grpc_connectivity_manager_go.OfflinePolicy_DRAIN)
+		for check := 0; check < 6; check++ {
+			env.Advance(threshold / 2)
+			env.SendClusterAlive(organizationID, clusterID)
+			now := env.Clock.Now().Unix()
+			gomega.Eventually(lastAlive, waitTimeout, testhelpers.PollInterval).Should(gomega.Equal(now))
+			gomega.Expect(env.SystemModel.Status(organizationID, clusterID)).To(gomega.Equal(grpc_connectivity_manager_go.ClusterStatus_ONLINE))
+		}
+		gomega.Expect(env.StatusChanges()).To(gomega.BeEmpty())
+		gomega.Expect(env.DrainRequests()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should set offline, cordon and drain a silent cluster and bring it back online cordoned", func() {
+		launch(grpc_connectivity_manager_go.OfflinePolicy_DRAIN)
+
+		env.Advance(threshold)
+		gomega.Expect(env.WaitForStatus(organizationID, clusterID, grpc_connectivity_manager_go.ClusterStatus_OFFLINE, waitTimeout)).To(gomega.BeTrue())
+		gomega.Expect(env.DrainRequests()).To(gomega.BeEmpty())
+
+		env.Advance(gracePeriod - threshold)
+		gomega.Expect(env.WaitForStatus(organizationID, clusterID, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, waitTimeout)).To(gomega.BeTrue())
+		// the drain is sent by the next dispatch of the queue
+		gomega.Eventually(func() int {
+			env.Advance(time.Second)
+			return len(env.DrainRequests())
+		}, waitTimeout, testhelpers.PollInterval).Should(gomega.Equal(1))
+		sent := env.DrainRequests()[0]
+		gomega.Expect(sent.ClusterId.OrganizationId).To(gomega.Equal(organizationID))
+		gomega.Expect(sent.ClusterId.ClusterId).To(gomega.Equal(clusterID))
+		gomega.Expect(sent.ClusterOffline).To(gomega.BeTrue())
+		gomega.Eventually(drainLabel, waitTimeout, testhelpers.PollInterval).Should(gomega.Equal(drain.SentState))
+
+		env.SendClusterAlive(organizationID, clusterID)
+		gomega.Expect(env.WaitForStatus(organizationID, clusterID, grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, waitTimeout)).To(gomega.BeTrue())
+		gomega.Eventually(drainLabel, waitTimeout, testhelpers.PollInterval).Should(gomega.BeEmpty())
+
+		changes := env.StatusChanges()
+		gomega.Expect(changes).To(gomega.HaveLen(3))
+		gomega.Expect(changes[0].NewStatus).To(gomega.Equal(grpc_connectivity_manager_go.ClusterStatus_OFFLINE))
+		gomega.Expect(changes[1].NewStatus).To(gomega.Equal(grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON))
+		gomega.Expect(changes[2].NewStatus).To(gomega.Equal(grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON))
+		// a single drain per outage
+		gomega.Expect(env.DrainRequests()).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should not drain a silent cluster without offline policy", func() {
+		launch(grpc_connectivity_manager_go.OfflinePolicy_NONE)
+		env.Advance(gracePeriod)
+		gomega.Expect(env.WaitForStatus(organizationID, clusterID, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, waitTimeout)).To(gomega.BeTrue())
+		gomega.Consistently(func() int {
+			env.Advance(time.Second)
+			return len(env.DrainRequests())
+		}, time.Second, testhelpers.PollInterval).Should(gomega.Equal(0))
+	})
+
+	ginkgo.It("should release its ports once stopped", func() {
+		launch(grpc_connectivity_manager_go.OfflinePolicy_NONE)
+		ports := []uint32{env.Config.Port, env.Config.MetricsPort}
+		env.Stop()
+		env = nil
+		for _, port := range ports {
+			lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(lis.Close()).To(gomega.Succeed())
+		}
+	})
+})
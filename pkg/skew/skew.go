@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skew
+
+import (
+	"sync"
+	"time"
+)
+
+// Skew of the clock of a cluster with respect to the clock of the component.
+type Skew struct {
+	// Offset with the difference between the timestamp of the last cluster alive check and its reception,
+	// positive if the clock of the cluster is ahead. It includes the transmission delay.
+	Offset time.Duration
+	// Exceeded is true if the offset is beyond the tolerance.
+	Exceeded bool
+}
+
+// Tracker keeps the clock skew of the clusters observed on their cluster alive checks.
+type Tracker struct {
+	sync.Mutex
+	tolerance time.Duration
+	skews     map[string]Skew
+}
+
+// NewTracker creates a tracker that flags the clusters whose skew is beyond a tolerance.
+func NewTracker(tolerance time.Duration) *Tracker {
+	return &Tracker{
+		tolerance: tolerance,
+		skews:     make(map[string]Skew, 0),
+	}
+}
+
+// SetTolerance replaces the tolerance, applied from the next observation of each cluster.
+func (t *Tracker) SetTolerance(tolerance time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.tolerance = tolerance
+}
+
+// Observe records the skew of a cluster alive check sent at sent and received at received. It returns the
+// new skew and true if the cluster has just exceeded the tolerance or gone back within it.
+func (t *Tracker) Observe(key string, sent time.Time, received time.Time) (Skew, bool) {
+	offset := sent.Sub(received)
+	abs := offset
+	if abs < 0 {
+		abs = -abs
+	}
+	t.Lock()
+	defer t.Unlock()
+	current := Skew{Offset: offset, Exceeded: abs > t.tolerance}
+	previous, exists := t.skews[key]
+	t.skews[key] = current
+	return current, (exists || current.Exceeded) && previous.Exceeded != current.Exceeded
+}
+
+// Get returns the last skew observed for a cluster.
+func (t *Tracker) Get(key string) (Skew, bool) {
+	t.Lock()
+	defer t.Unlock()
+	current, exists := t.skews[key]
+	return current, exists
+}
+
+// Forget removes the skew of a cluster, returning the last one observed.
+func (t *Tracker) Forget(key string) (Skew, bool) {
+	t.Lock()
+	defer t.Unlock()
+	current, exists := t.skews[key]
+	delete(t.skews, key)
+	return current, exists
+}
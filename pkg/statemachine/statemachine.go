@@ -0,0 +1,170 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statemachine
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+)
+
+// Trigger represents the event that causes a cluster status transition.
+type Trigger int
+
+const (
+	// Alive is fired when a ClusterAlive check is received.
+	Alive Trigger = iota + 1
+	// ThresholdExpired is fired when no ClusterAlive check has been received for longer than the threshold.
+	ThresholdExpired
+	// GracePeriodExpired is fired when no ClusterAlive check has been received for longer than the grace period.
+	GracePeriodExpired
+	// Cordon is fired when the cluster is cordoned manually.
+	Cordon
+	// Uncordon is fired when the recovery policy decides that a recovered cluster can be used again.
+	Uncordon
+)
+
+var triggerNames = map[Trigger]string{
+	Alive:              "alive",
+	ThresholdExpired:   "threshold_expired",
+	GracePeriodExpired: "grace_period_expired",
+	Cordon:             "cordon",
+	Uncordon:           "uncordon",
+}
+
+func (t Trigger) String() string {
+	name, exists := triggerNames[t]
+	if !exists {
+		return fmt.Sprintf("trigger(%d)", int(t))
+	}
+	return name
+}
+
+// SideEffect represents an action that must be executed after a transition has been applied.
+type SideEffect int
+
+const (
+	// ApplyOfflinePolicy requests the configured offline policy to be triggered on the cluster.
+	ApplyOfflinePolicy SideEffect = iota + 1
+	// StartRecovery starts tracking the cluster with the recovery policy.
+	StartRecovery
+	// NotifyUncordon sends the uncordon request of the cluster to the bus.
+	NotifyUncordon
+)
+
+var sideEffectNames = map[SideEffect]string{
+	ApplyOfflinePolicy: "apply_offline_policy",
+	StartRecovery:      "start_recovery",
+	NotifyUncordon:     "notify_uncordon",
+}
+
+func (s SideEffect) String() string {
+	name, exists := sideEffectNames[s]
+	if !exists {
+		return fmt.Sprintf("side_effect(%d)", int(s))
+	}
+	return name
+}
+
+// Transition defines an allowed change of status.
+type Transition struct {
+	// From is the status of the cluster before the transition.
+	From grpc_connectivity_manager_go.ClusterStatus
+	// Trigger is the event that fires the transition.
+	Trigger Trigger
+	// To is the status of the cluster after the transition.
+	To grpc_connectivity_manager_go.ClusterStatus
+	// SideEffects contains the actions to execute once the transition has been applied.
+	SideEffects []SideEffect
+}
+
+// Changed returns true if the transition modifies the status of the cluster.
+func (t Transition) Changed() bool {
+	return t.From != t.To
+}
+
+// ClusterStatusTransitions contains the transitions allowed between cluster status.
+var ClusterStatusTransitions = []Transition{
+	// A cluster alive check brings the cluster back online keeping the cordon.
+	{From: grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE},
+	{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE},
+	{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON},
+	{From: grpc_connectivity_manager_go.ClusterStatus_OFFLINE, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE},
+	{From: grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON,
+		SideEffects: []SideEffect{StartRecovery}},
+	// Missing the threshold moves online clusters to offline keeping the cordon.
+	{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE, Trigger: ThresholdExpired, To: grpc_connectivity_manager_go.ClusterStatus_OFFLINE},
+	{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, Trigger: ThresholdExpired, To: grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON},
+	// Missing the grace period cordons the offline cluster and triggers the offline policy.
+	{From: grpc_connectivity_manager_go.ClusterStatus_OFFLINE, Trigger: GracePeriodExpired, To: grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON,
+		SideEffects: []SideEffect{ApplyOfflinePolicy}},
+	// Manual cordon.
+	{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE, Trigger: Cordon, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON},
+	{From: grpc_connectivity_manager_go.ClusterStatus_OFFLINE, Trigger: Cordon, To: grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON},
+	// Automatic uncordon of a recovered cluster.
+	{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, Trigger: Uncordon, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE,
+		SideEffects: []SideEffect{NotifyUncordon}},
+}
+
+type transitionKey struct {
+	from    grpc_connectivity_manager_go.ClusterStatus
+	trigger Trigger
+}
+
+// StateMachine structure that resolves the status transitions of a cluster.
+type StateMachine struct {
+	transitions map[transitionKey]Transition
+}
+
+// NewStateMachine creates a state machine with a given set of transitions. If two transitions share the
+// same origin status and trigger, the last one prevails.
+func NewStateMachine(transitions []Transition) *StateMachine {
+	sm := &StateMachine{transitions: make(map[transitionKey]Transition, len(transitions))}
+	for _, t := range transitions {
+		sm.transitions[transitionKey{from: t.From, trigger: t.Trigger}] = t
+	}
+	return sm
+}
+
+// NewClusterStatusStateMachine creates a state machine with the cluster status transitions.
+func NewClusterStatusStateMachine() *StateMachine {
+	return NewStateMachine(ClusterStatusTransitions)
+}
+
+// Allowed returns true if the trigger can be fired from the given status.
+func (sm *StateMachine) Allowed(from grpc_connectivity_manager_go.ClusterStatus, trigger Trigger) bool {
+	_, exists := sm.transitions[transitionKey{from: from, trigger: trigger}]
+	return exists
+}
+
+// Next returns the transition that results of firing a trigger from the given status.
+func (sm *StateMachine) Next(from grpc_connectivity_manager_go.ClusterStatus, trigger Trigger) (*Transition, derrors.Error) {
+	transition, exists := sm.transitions[transitionKey{from: from, trigger: trigger}]
+	if !exists {
+		return nil, derrors.NewFailedPreconditionError("invalid cluster status transition").WithParams(from.String(), trigger.String())
+	}
+	return &transition, nil
+}
+
+// Transitions returns the list of allowed transitions.
+func (sm *StateMachine) Transitions() []Transition {
+	result := make([]Transition, 0, len(sm.transitions))
+	for _, t := range sm.transitions {
+		result = append(result, t)
+	}
+	return result
+}
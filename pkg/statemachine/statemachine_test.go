@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statemachine
+
+import (
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Cluster status state machine", func() {
+
+	sm := NewClusterStatusStateMachine()
+
+	allowed := func(from grpc_connectivity_manager_go.ClusterStatus, trigger Trigger, to grpc_connectivity_manager_go.ClusterStatus, sideEffects ...SideEffect) {
+		gomega.Expect(sm.Allowed(from, trigger)).To(gomega.BeTrue())
+		transition, err := sm.Next(from, trigger)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(transition.From).To(gomega.Equal(from))
+		gomega.Expect(transition.Trigger).To(gomega.Equal(trigger))
+		gomega.Expect(transition.To).To(gomega.Equal(to))
+		gomega.Expect(transition.Changed()).To(gomega.Equal(from != to))
+		if len(sideEffects) == 0 {
+			gomega.Expect(transition.SideEffects).To(gomega.BeEmpty())
+		} else {
+			gomega.Expect(transition.SideEffects).To(gomega.Equal(sideEffects))
+		}
+	}
+
+	rejected := func(from grpc_connectivity_manager_go.ClusterStatus, trigger Trigger) {
+		gomega.Expect(sm.Allowed(from, trigger)).To(gomega.BeFalse())
+		transition, err := sm.Next(from, trigger)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(transition).To(gomega.BeNil())
+	}
+
+	table.DescribeTable("alive", allowed,
+		table.Entry("from UNKNOWN", grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, Alive, grpc_connectivity_manager_go.ClusterStatus_ONLINE),
+		table.Entry("from ONLINE", grpc_connectivity_manager_go.ClusterStatus_ONLINE, Alive, grpc_connectivity_manager_go.ClusterStatus_ONLINE),
+		table.Entry("from ONLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, Alive, grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON),
+		table.Entry("from OFFLINE", grpc_connectivity_manager_go.ClusterStatus_OFFLINE, Alive, grpc_connectivity_manager_go.ClusterStatus_ONLINE),
+		table.Entry("from OFFLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, Alive, grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, StartRecovery),
+	)
+
+	table.DescribeTable("threshold expired", allowed,
+		table.Entry("from ONLINE", grpc_connectivity_manager_go.ClusterStatus_ONLINE, ThresholdExpired, grpc_connectivity_manager_go.ClusterStatus_OFFLINE),
+		table.Entry("from ONLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, ThresholdExpired, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON),
+	)
+
+	table.DescribeTable("grace period expired", allowed,
+		table.Entry("from OFFLINE", grpc_connectivity_manager_go.ClusterStatus_OFFLINE, GracePeriodExpired, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, ApplyOfflinePolicy),
+	)
+
+	table.DescribeTable("cordon", allowed,
+		table.Entry("from ONLINE", grpc_connectivity_manager_go.ClusterStatus_ONLINE, Cordon, grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON),
+		table.Entry("from OFFLINE", grpc_connectivity_manager_go.ClusterStatus_OFFLINE, Cordon, grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON),
+	)
+
+	table.DescribeTable("uncordon", allowed,
+		table.Entry("from ONLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, Uncordon, grpc_connectivity_manager_go.ClusterStatus_ONLINE, NotifyUncordon),
+	)
+
+	table.DescribeTable("rejected transitions", rejected,
+		table.Entry("threshold expired from UNKNOWN", grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, ThresholdExpired),
+		table.Entry("threshold expired from OFFLINE", grpc_connectivity_manager_go.ClusterStatus_OFFLINE, ThresholdExpired),
+		table.Entry("threshold expired from OFFLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, ThresholdExpired),
+		table.Entry("grace period expired from UNKNOWN", grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, GracePeriodExpired),
+		table.Entry("grace period expired from ONLINE", grpc_connectivity_manager_go.ClusterStatus_ONLINE, GracePeriodExpired),
+		table.Entry("grace period expired from ONLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, GracePeriodExpired),
+		table.Entry("grace period expired from OFFLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, GracePeriodExpired),
+		table.Entry("cordon from UNKNOWN", grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, Cordon),
+		table.Entry("cordon from ONLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON, Cordon),
+		table.Entry("cordon from OFFLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, Cordon),
+		table.Entry("uncordon from UNKNOWN", grpc_connectivity_manager_go.ClusterStatus_UNKNOWN, Uncordon),
+		table.Entry("uncordon from ONLINE", grpc_connectivity_manager_go.ClusterStatus_ONLINE, Uncordon),
+		table.Entry("uncordon from OFFLINE", grpc_connectivity_manager_go.ClusterStatus_OFFLINE, Uncordon),
+		table.Entry("uncordon from OFFLINE_CORDON", grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON, Uncordon),
+		table.Entry("unknown trigger", grpc_connectivity_manager_go.ClusterStatus_ONLINE, Trigger(0)),
+	)
+
+	ginkgo.It("should cover every status and trigger", func() {
+		statuses := []grpc_connectivity_manager_go.ClusterStatus{
+			grpc_connectivity_manager_go.ClusterStatus_UNKNOWN,
+			grpc_connectivity_manager_go.ClusterStatus_ONLINE,
+			grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON,
+			grpc_connectivity_manager_go.ClusterStatus_OFFLINE,
+			grpc_connectivity_manager_go.ClusterStatus_OFFLINE_CORDON,
+		}
+		gomega.Expect(statuses).To(gomega.HaveLen(len(grpc_connectivity_manager_go.ClusterStatus_name)))
+		gomega.Expect(triggerNames).To(gomega.HaveLen(5))
+		allowedPairs := 0
+		for _, status := range statuses {
+			for trigger := range triggerNames {
+				if sm.Allowed(status, trigger) {
+					allowedPairs++
+				}
+			}
+		}
+		// the allowed entries above, the rest of the pairs are in the rejected table
+		gomega.Expect(allowedPairs).To(gomega.Equal(11))
+		gomega.Expect(sm.Transitions()).To(gomega.HaveLen(len(ClusterStatusTransitions)))
+	})
+
+	ginkgo.It("should let the last transition prevail for the same status and trigger", func() {
+		custom := NewStateMachine([]Transition{
+			{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE},
+			{From: grpc_connectivity_manager_go.ClusterStatus_ONLINE, Trigger: Alive, To: grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON},
+		})
+		transition, err := custom.Next(grpc_connectivity_manager_go.ClusterStatus_ONLINE, Alive)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(transition.To).To(gomega.Equal(grpc_connectivity_manager_go.ClusterStatus_ONLINE_CORDON))
+		gomega.Expect(custom.Transitions()).To(gomega.HaveLen(1))
+	})
+})
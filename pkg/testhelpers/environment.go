@@ -0,0 +1,255 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testhelpers
+
+import (
+	"fmt"
+	"github.com/nalej/connectivity-manager/pkg/bus"
+	"github.com/nalej/connectivity-manager/pkg/clock"
+	"github.com/nalej/connectivity-manager/pkg/detector"
+	"github.com/nalej/connectivity-manager/pkg/election"
+	"github.com/nalej/connectivity-manager/pkg/recovery"
+	"github.com/nalej/connectivity-manager/pkg/server"
+	"github.com/nalej/connectivity-manager/pkg/server/config"
+	"github.com/nalej/derrors"
+	grpc_conductor_go "github.com/nalej/grpc-conductor-go"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	"net"
+	"time"
+)
+
+const (
+	// PollInterval between checks while waiting for a condition.
+	PollInterval = 50 * time.Millisecond
+	// StopTimeout with the time given to the service to finish its loops once stopped.
+	StopTimeout = 10 * time.Second
+)
+
+// Environment runs the whole component through Service.Run against a fake system model and an in-memory bus.
+type Environment struct {
+	Clock       *clock.FakeClock
+	SystemModel *SystemModel
+	Bus         *bus.MemoryBus
+	Service     *server.Service
+	Config      config.Config
+	// stopped is closed once Service.Run returns
+	stopped chan struct{}
+}
+
+// NewEnvironment launches the fake system model and the service with the given configuration. The ports,
+// the system model address and the queue address are overwritten, and the cache, resync, clock skew, webhook,
+// detector, recovery and leader election settings get defaults if not set, with a short webhook backoff and a
+// single replica. The cluster alive checks are written to system model immediately unless HeartbeatFlushInterval
+// is set.
+func NewEnvironment(conf config.Config) (*Environment, derrors.Error) {
+	systemModel := NewSystemModel()
+	if err := systemModel.Launch(); err != nil {
+		return nil, err
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	metricsPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	conf.Port = port
+	conf.MetricsPort = metricsPort
+	conf.SystemModelAddress = systemModel.Address()
+	conf.QueueAddress = "memory"
+	if conf.PlatformGracePeriod == 0 {
+		conf.PlatformGracePeriod = 2 * time.Minute
+		if conf.Threshold >= conf.PlatformGracePeriod {
+			conf.PlatformGracePeriod = 2 * conf.Threshold
+		}
+	}
+	if conf.ClusterCacheSize == 0 {
+		conf.ClusterCacheSize = 1000
+	}
+	if conf.HeartbeatPeriod == 0 {
+		conf.HeartbeatPeriod = (conf.Threshold - conf.HeartbeatFlushInterval) / 2
+	}
+	if conf.ResyncInterval == 0 {
+		conf.ResyncInterval = 10 * time.Minute
+	}
+	if conf.SweepConcurrency == 0 {
+		conf.SweepConcurrency = 4
+	}
+	if conf.SweepTimeout == 0 {
+		conf.SweepTimeout = 5 * time.Minute
+	}
+	if conf.MaxConcurrentDrains == 0 {
+		conf.MaxConcurrentDrains = 5
+	}
+	if conf.DrainDuration == 0 {
+		conf.DrainDuration = 5 * time.Minute
+	}
+	if conf.ClockSkewTolerance == 0 {
+		conf.ClockSkewTolerance = 30 * time.Second
+	}
+	if conf.WebhookAttempts == 0 {
+		conf.WebhookAttempts = 5
+	}
+	if conf.WebhookBackoff == 0 {
+		conf.WebhookBackoff = 10 * time.Millisecond
+	}
+	if conf.HeartbeatMaxAge == 0 {
+		conf.HeartbeatMaxAge = 5 * time.Minute
+	}
+	if conf.RecoveryPolicy == "" {
+		conf.RecoveryPolicy = recovery.None
+	}
+	if conf.Detector == "" {
+		conf.Detector = detector.Threshold
+	}
+	if conf.PhiThreshold == 0 {
+		conf.PhiThreshold = detector.DefaultPhiThreshold
+	}
+	if conf.LeaderElection == "" {
+		conf.LeaderElection = election.None
+	}
+	if problems := conf.Problems(); len(problems) > 0 {
+		systemModel.Stop()
+		return nil, derrors.NewInvalidArgumentError("invalid environment configuration", problems[0]).WithParams(len(problems))
+	}
+
+	fakeClock := clock.NewFakeClock(time.Now())
+	memoryBus := bus.NewMemoryBus()
+	service, sErr := server.NewService(&conf)
+	if sErr != nil {
+		return nil, derrors.AsError(sErr, "cannot create service")
+	}
+	service.WithBusClients(&server.BusClients{
+		InfrastructureEventsConsumer: memoryBus.EventsConsumer(),
+		InfrastructureOpsProducer:    memoryBus.OpsProducer(),
+		InfrastructureEventsProducer: memoryBus.EventsProducer(),
+	})
+	service.WithClock(fakeClock)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		service.Run()
+	}()
+
+	if err := waitForPort(conf.Port, 10*time.Second); err != nil {
+		return nil, err
+	}
+	return &Environment{
+		Clock:       fakeClock,
+		SystemModel: systemModel,
+		Bus:         memoryBus,
+		Service:     service,
+		Config:      conf,
+		stopped:     stopped,
+	}, nil
+}
+
+// Stop the service, waiting for its loops to finish, and the fake system model.
+func (e *Environment) Stop() {
+	e.Service.Stop()
+	select {
+	case <-e.stopped:
+	case <-time.After(StopTimeout):
+	}
+	e.SystemModel.Stop()
+}
+
+// Advance moves the fake clock forward, firing the expiration loop for every elapsed threshold.
+func (e *Environment) Advance(d time.Duration) {
+	e.Clock.Advance(d)
+}
+
+// SendClusterAlive publishes a cluster alive check with the current time of the fake clock.
+func (e *Environment) SendClusterAlive(organizationID string, clusterID string) {
+	e.SendClusterAliveAt(organizationID, clusterID, e.Clock.Now().Unix())
+}
+
+// SendClusterAliveAt publishes a cluster alive check with a given timestamp on the in-memory bus.
+func (e *Environment) SendClusterAliveAt(organizationID string, clusterID string, timestamp int64) {
+	e.Bus.PublishClusterAlive(&grpc_connectivity_manager_go.ClusterAlive{
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		Timestamp:      timestamp,
+	})
+}
+
+// SendSignedClusterAliveAt publishes a cluster alive check with a given timestamp and signature.
+func (e *Environment) SendSignedClusterAliveAt(organizationID string, clusterID string, timestamp int64, signature string) {
+	e.Bus.PublishClusterAlive(&grpc_connectivity_manager_go.ClusterAlive{
+		OrganizationId: organizationID,
+		ClusterId:      clusterID,
+		Timestamp:      timestamp,
+		Signature:      signature,
+	})
+}
+
+// WaitForStatus waits until a cluster reaches the expected status in the fake system model.
+func (e *Environment) WaitForStatus(organizationID string, clusterID string, expected grpc_connectivity_manager_go.ClusterStatus, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if e.SystemModel.Status(organizationID, clusterID) == expected {
+			return true
+		}
+		time.Sleep(PollInterval)
+	}
+	return false
+}
+
+// DrainRequests returns the drain requests sent to the infrastructure ops queue.
+func (e *Environment) DrainRequests() []*grpc_conductor_go.DrainClusterRequest {
+	result := make([]*grpc_conductor_go.DrainClusterRequest, 0)
+	for _, msg := range e.Bus.OpsMessages() {
+		if drain, ok := msg.(*grpc_conductor_go.DrainClusterRequest); ok {
+			result = append(result, drain)
+		}
+	}
+	return result
+}
+
+// StatusChanges returns the status changed events sent to the infrastructure events queue.
+func (e *Environment) StatusChanges() []*grpc_connectivity_manager_go.ClusterStatusChanged {
+	result := make([]*grpc_connectivity_manager_go.ClusterStatusChanged, 0)
+	for _, msg := range e.Bus.EventsMessages() {
+		if changed, ok := msg.(*grpc_connectivity_manager_go.ClusterStatusChanged); ok {
+			result = append(result, changed)
+		}
+	}
+	return result
+}
+
+func freePort() (uint32, derrors.Error) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, derrors.AsError(err, "cannot obtain a free port")
+	}
+	defer lis.Close()
+	return uint32(lis.Addr().(*net.TCPAddr).Port), nil
+}
+
+func waitForPort(port uint32, timeout time.Duration) derrors.Error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(PollInterval)
+	}
+	return derrors.NewUnavailableError("service not listening").WithParams(port)
+}
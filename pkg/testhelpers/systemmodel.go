@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testhelpers
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"github.com/nalej/derrors"
+	grpc_common_go "github.com/nalej/grpc-common-go"
+	grpc_connectivity_manager_go "github.com/nalej/grpc-connectivity-manager-go"
+	grpc_infrastructure_go "github.com/nalej/grpc-infrastructure-go"
+	grpc_organization_go "github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"google.golang.org/grpc"
+	"net"
+	"sync"
+)
+
+// SystemModel is an in-process fake of the system model component that stores organizations and clusters
+// in memory. Only the methods used by the connectivity manager are implemented.
+type SystemModel struct {
+	sync.Mutex
+	organizations map[string]*grpc_organization_go.Organization
+	// clusters indexed by organization identifier and cluster identifier.
+	clusters map[string]map[string]*grpc_infrastructure_go.Cluster
+	server   *grpc.Server
+	address  string
+}
+
+// NewSystemModel creates an empty fake system model.
+func NewSystemModel() *SystemModel {
+	return &SystemModel{
+		organizations: make(map[string]*grpc_organization_go.Organization, 0),
+		clusters:      make(map[string]map[string]*grpc_infrastructure_go.Cluster, 0),
+	}
+}
+
+// Launch starts serving the fake system model on a random local port.
+func (sm *SystemModel) Launch() derrors.Error {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return derrors.AsError(err, "cannot listen for the fake system model")
+	}
+	sm.address = lis.Addr().String()
+	sm.server = grpc.NewServer()
+	grpc_infrastructure_go.RegisterClustersServer(sm.server, &clustersServer{sm: sm})
+	grpc_organization_go.RegisterOrganizationsServer(sm.server, &organizationsServer{sm: sm})
+	go sm.server.Serve(lis)
+	return nil
+}
+
+// Address returns the host:port where the fake system model is listening.
+func (sm *SystemModel) Address() string {
+	return sm.address
+}
+
+// Stop the fake system model.
+func (sm *SystemModel) Stop() {
+	if sm.server != nil {
+		sm.server.Stop()
+	}
+}
+
+// AddOrganization stores a new organization.
+func (sm *SystemModel) AddOrganization(organizationID string) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.addOrganization(organizationID)
+}
+
+func (sm *SystemModel) addOrganization(organizationID string) {
+	sm.organizations[organizationID] = &grpc_organization_go.Organization{
+		OrganizationId: organizationID,
+		Name:           organizationID,
+	}
+	if _, exists := sm.clusters[organizationID]; !exists {
+		sm.clusters[organizationID] = make(map[string]*grpc_infrastructure_go.Cluster, 0)
+	}
+}
+
+// AddCluster stores a new cluster, creating its organization if required.
+func (sm *SystemModel) AddCluster(cluster *grpc_infrastructure_go.Cluster) {
+	sm.Lock()
+	defer sm.Unlock()
+	if _, exists := sm.organizations[cluster.OrganizationId]; !exists {
+		sm.addOrganization(cluster.OrganizationId)
+	}
+	sm.clusters[cluster.OrganizationId][cluster.ClusterId] = proto.Clone(cluster).(*grpc_infrastructure_go.Cluster)
+}
+
+// Cluster returns a copy of a stored cluster.
+func (sm *SystemModel) Cluster(organizationID string, clusterID string) (*grpc_infrastructure_go.Cluster, derrors.Error) {
+	sm.Lock()
+	defer sm.Unlock()
+	cluster, exists := sm.clusters[organizationID][clusterID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("cluster").WithParams(organizationID, clusterID)
+	}
+	return proto.Clone(cluster).(*grpc_infrastructure_go.Cluster), nil
+}
+
+// Status returns the status of a stored cluster.
+func (sm *SystemModel) Status(organizationID string, clusterID string) grpc_connectivity_manager_go.ClusterStatus {
+	cluster, err := sm.Cluster(organizationID, clusterID)
+	if err != nil {
+		return grpc_connectivity_manager_go.ClusterStatus_UNKNOWN
+	}
+	return cluster.ClusterStatus
+}
+
+// ShiftLastAlive moves the last alive timestamp of a cluster by a number of seconds, simulating the
+// elapsed time since the last cluster alive check.
+func (sm *SystemModel) ShiftLastAlive(organizationID string, clusterID string, seconds int64) {
+	sm.Lock()
+	defer sm.Unlock()
+	if cluster, exists := sm.clusters[organizationID][clusterID]; exists {
+		cluster.LastAliveTimestamp += seconds
+	}
+}
+
+type clustersServer struct {
+	// Unimplemented methods of the interface panic if called.
+	grpc_infrastructure_go.ClustersServer
+	sm *SystemModel
+}
+
+func (s *clustersServer) GetCluster(ctx context.Context, clusterID *grpc_infrastructure_go.ClusterId) (*grpc_infrastructure_go.Cluster, error) {
+	cluster, err := s.sm.Cluster(clusterID.OrganizationId, clusterID.ClusterId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return cluster, nil
+}
+
+func (s *clustersServer) ListClusters(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_infrastructure_go.ClusterList, error) {
+	s.sm.Lock()
+	defer s.sm.Unlock()
+	clusters, exists := s.sm.clusters[organizationID.OrganizationId]
+	if !exists {
+		return nil, conversions.ToGRPCError(derrors.NewNotFoundError("organization").WithParams(organizationID.OrganizationId))
+	}
+	result := make([]*grpc_infrastructure_go.Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		result = append(result, proto.Clone(cluster).(*grpc_infrastructure_go.Cluster))
+	}
+	return &grpc_infrastructure_go.ClusterList{Clusters: result}, nil
+}
+
+// UpdateCluster applies the status, the timestamp and the label updates. As in system model, the last alive timestamp
+// follows the timestamp reported by the cluster.
+func (s *clustersServer) UpdateCluster(ctx context.Context, request *grpc_infrastructure_go.UpdateClusterRequest) (*grpc_infrastructure_go.Cluster, error) {
+	s.sm.Lock()
+	defer s.sm.Unlock()
+	cluster, exists := s.sm.clusters[request.OrganizationId][request.ClusterId]
+	if !exists {
+		return nil, conversions.ToGRPCError(derrors.NewNotFoundError("cluster").WithParams(request.OrganizationId, request.ClusterId))
+	}
+	if request.UpdateStatus {
+		cluster.ClusterStatus = request.Status
+	}
+	if request.UpdateLastClusterTimestamp {
+		cluster.LastClusterTimestamp = request.LastClusterTimestamp
+		cluster.LastAliveTimestamp = request.LastClusterTimestamp
+	}
+	if request.AddLabels || request.RemoveLabels {
+		if cluster.Labels == nil {
+			cluster.Labels = make(map[string]string, len(request.Labels))
+		}
+		for name, value := range request.Labels {
+			if request.RemoveLabels {
+				delete(cluster.Labels, name)
+			} else {
+				cluster.Labels[name] = value
+			}
+		}
+	}
+	return proto.Clone(cluster).(*grpc_infrastructure_go.Cluster), nil
+}
+
+type organizationsServer struct {
+	// Unimplemented methods of the interface panic if called.
+	grpc_organization_go.OrganizationsServer
+	sm *SystemModel
+}
+
+func (s *organizationsServer) ListOrganizations(ctx context.Context, empty *grpc_common_go.Empty) (*grpc_organization_go.OrganizationList, error) {
+	s.sm.Lock()
+	defer s.sm.Unlock()
+	result := make([]*grpc_organization_go.Organization, 0, len(s.sm.organizations))
+	for _, organization := range s.sm.organizations {
+		result = append(result, proto.Clone(organization).(*grpc_organization_go.Organization))
+	}
+	return &grpc_organization_go.OrganizationList{Organizations: result}, nil
+}
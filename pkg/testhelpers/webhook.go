@@ -0,0 +1,124 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testhelpers
+
+import (
+	"encoding/json"
+	"github.com/nalej/connectivity-manager/pkg/notification"
+	"github.com/nalej/derrors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ReceivedNotification is a request received by the webhook server.
+type ReceivedNotification struct {
+	Notification notification.Notification
+	DeliveryId   string
+	// ValidSignature is true if the request was signed with the secret of the server.
+	ValidSignature bool
+}
+
+// WebhookServer is a local HTTP server that records the notifications posted by the connectivity manager.
+type WebhookServer struct {
+	sync.Mutex
+	secret   string
+	server   *httptest.Server
+	received []ReceivedNotification
+	failures int
+}
+
+// NewWebhookServer launches a webhook server that verifies the signatures with the given secret.
+func NewWebhookServer(secret string) *WebhookServer {
+	webhook := &WebhookServer{
+		secret:   secret,
+		received: make([]ReceivedNotification, 0),
+	}
+	webhook.server = httptest.NewServer(http.HandlerFunc(webhook.handle))
+	return webhook
+}
+
+func (w *WebhookServer) handle(writer http.ResponseWriter, request *http.Request) {
+	w.Lock()
+	defer w.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var received notification.Notification
+	if err := json.Unmarshal(body, &received); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.received = append(w.received, ReceivedNotification{
+		Notification:   received,
+		DeliveryId:     request.Header.Get(notification.DeliveryHeader),
+		ValidSignature: notification.Verify(w.secret, body, request.Header.Get(notification.SignatureHeader)),
+	})
+	writer.WriteHeader(http.StatusOK)
+}
+
+// Endpoint returns the endpoint to add to the webhook configuration.
+func (w *WebhookServer) Endpoint() notification.Endpoint {
+	return notification.Endpoint{URL: w.server.URL, Secret: w.secret}
+}
+
+// FailNext makes the server answer the next requests with an error, to exercise the retries.
+func (w *WebhookServer) FailNext(requests int) {
+	w.Lock()
+	defer w.Unlock()
+	w.failures = requests
+}
+
+// Received returns the notifications received so far.
+func (w *WebhookServer) Received() []ReceivedNotification {
+	w.Lock()
+	defer w.Unlock()
+	result := make([]ReceivedNotification, len(w.received))
+	copy(result, w.received)
+	return result
+}
+
+// Stop the webhook server.
+func (w *WebhookServer) Stop() {
+	w.server.Close()
+}
+
+// WriteWebhookConfig writes a webhook configuration to a temporary file and returns its path, to be set as
+// the WebhookFile of the environment configuration.
+func WriteWebhookConfig(config *notification.Config) (string, derrors.Error) {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return "", derrors.AsError(err, "cannot marshal webhook configuration")
+	}
+	file, err := ioutil.TempFile("", "webhooks-*.json")
+	if err != nil {
+		return "", derrors.AsError(err, "cannot create webhook file")
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		return "", derrors.AsError(err, "cannot write webhook file")
+	}
+	return file.Name(), nil
+}